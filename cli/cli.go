@@ -1 +1,222 @@
-package main
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	"crawler/common"
+	"crawler/config"
+)
+
+// ErrUsage is wrapped by ParseFlags errors that the flag package has
+// already printed along with the usage message. Other errors, such as an
+// unreadable config file, are left for the caller to report.
+var ErrUsage = errors.New("invalid usage")
+
+// ParseFlags parses command-line arguments into CLIFlags. Seed URLs may be
+// given with -seeds as a comma-separated list, as positional arguments and
+// in a -seed-file.
+//
+// When -config names a file, its values replace the built-in defaults and
+// any flag given explicitly overrides them in turn.
+func ParseFlags(args []string) (*common.CLIFlags, error) {
+	base := config.DefaultConfig()
+	configFile := configPath(args)
+	if configFile != "" {
+		var err error
+		if base, err = config.LoadConfig(configFile); err != nil {
+			return nil, err
+		}
+	}
+
+	// Jobs have no flags and come from the config file only.
+	flags := &common.CLIFlags{ConfigFile: configFile, Jobs: base.Jobs}
+	fs := flag.NewFlagSet("crawler", flag.ContinueOnError)
+
+	var seeds, trackingParams, allowedDomains, contentTypes, authHosts string
+	var numWorkers, maxPerHost, maxDepth, maxPages, maxRetries, maxRedirects, burst, batchSize int
+	var maxURLLength, maxSegments, maxRepeats, breakerThreshold int
+	fs.StringVar(&flags.ConfigFile, "config", configFile, "YAML or JSON config file; flags override its values")
+	fs.StringVar(&seeds, "seeds", strings.Join(base.SeedUrls, ","), "comma-separated list of seed URLs")
+	fs.StringVar(&flags.SeedFile, "seed-file", base.SeedFile, `file of seed URLs, one per line ("-" reads stdin)`)
+	fs.IntVar(&numWorkers, "workers", int(base.NumWorkers), "number of concurrent workers")
+	fs.IntVar(&maxPerHost, "max-per-host", int(base.MaxPerHost), "maximum concurrent requests to a single host (0 for unlimited)")
+	fs.IntVar(&maxDepth, "max-depth", int(base.MaxDepth), "maximum link depth from the seeds (0 for unlimited)")
+	fs.IntVar(&maxPages, "max-pages", int(base.MaxPages), "stop after storing this many pages (0 for unlimited)")
+	fs.DurationVar(&flags.CrawlDelay, "delay", base.CrawlDelay, "delay between requests made by a worker (ignored when -rps is set)")
+	fs.BoolVar(&flags.AdaptiveDelay, "adaptive-delay", base.AdaptiveDelay, "derive each host's delay from its response latency instead of -delay")
+	fs.DurationVar(&flags.MinDelay, "min-delay", base.MinDelay, "shortest adaptive delay")
+	fs.DurationVar(&flags.MaxDelay, "max-delay", base.MaxDelay, "longest adaptive delay")
+	fs.Float64Var(&flags.DelayFactor, "delay-factor", base.DelayFactor, "adaptive delay as a multiple of the host's last response latency")
+	fs.IntVar(&breakerThreshold, "breaker-threshold", int(base.BreakerThreshold), "consecutive failures after which a host is paused (0 never pauses)")
+	fs.DurationVar(&flags.BreakerCooldown, "breaker-cooldown", base.BreakerCooldown, "how long a failing host is paused before it is probed again")
+	fs.Float64Var(&flags.RequestsPerSecond, "rps", base.RequestsPerSecond, "global request rate shared by all workers (0 uses -delay instead)")
+	fs.IntVar(&burst, "burst", int(base.Burst), "requests allowed in a burst above -rps")
+	fs.IntVar(&maxRetries, "max-retries", int(base.MaxRetries), "retries for timeouts, connection resets and 5xx responses")
+	fs.IntVar(&maxRedirects, "max-redirects", int(base.MaxRedirects), "redirect hops to follow per request (-1 follows none)")
+	fs.DurationVar(&flags.BaseBackoff, "backoff", base.BaseBackoff, "initial delay between retries, doubled on every attempt")
+	fs.StringVar(&flags.StorageType, "storage", base.StorageType, "storage backend: postgres or memory")
+	fs.StringVar(&flags.OutputFormat, "output", base.OutputFormat, "write pages as jsonl or csv instead of using -storage")
+	fs.StringVar(&flags.OutputPath, "output-path", base.OutputPath, `file to write -output to ("-" for stdout)`)
+	fs.IntVar(&batchSize, "batch-size", int(base.BatchSize), "pages written to storage per batch (1 writes each page immediately)")
+	fs.DurationVar(&flags.FlushInterval, "flush-interval", base.FlushInterval, "longest a page waits in a partial batch (0 waits for a full batch)")
+	fs.StringVar(&flags.DBConnectionString, "db", base.DBConnectionString, "database connection string")
+	fs.StringVar(&flags.VisitedSet, "visited-set", base.VisitedSet, "visited set backend: map (exact) or bloom (bounded memory, rare false positives)")
+	fs.Int64Var(&flags.BloomExpectedURLs, "bloom-expected", base.BloomExpectedURLs, "URLs the bloom filter is sized for")
+	fs.Float64Var(&flags.BloomFPRate, "bloom-fp-rate", base.BloomFPRate, "bloom filter false positive rate at -bloom-expected URLs")
+	fs.StringVar(&flags.Frontier, "frontier", base.Frontier, "frontier backend: memory or disk (a BoltDB file at -frontier-path)")
+	fs.StringVar(&flags.FrontierPath, "frontier-path", base.FrontierPath, "file the disk frontier is kept in")
+	fs.StringVar(&flags.Fetcher, "fetcher", base.Fetcher, "page fetcher: http or headless (renders JavaScript in headless Chrome)")
+	fs.StringVar(&flags.StateFile, "state-file", base.StateFile, "file to save crawl state to and resume from")
+	fs.DurationVar(&flags.CheckpointInterval, "checkpoint-interval", base.CheckpointInterval, "how often to save crawl state (0 disables periodic checkpoints)")
+	fs.IntVar(&flags.MetricsPort, "metrics-port", base.MetricsPort, "port to serve Prometheus metrics on (0 disables)")
+	fs.IntVar(&flags.ControlPort, "control-port", base.ControlPort, "port to serve the control API on (0 disables)")
+	fs.StringVar(&flags.ControlHost, "control-host", base.ControlHost, "address to serve the control API on (0.0.0.0 for all interfaces)")
+	fs.DurationVar(&flags.ShutdownTimeout, "shutdown-timeout", base.ShutdownTimeout, "how long to wait for in-flight work after SIGINT/SIGTERM")
+	fs.BoolVar(&flags.DryRun, "dry-run", base.DryRun, "discover and print URLs without storing pages or crawl state")
+	fs.BoolVar(&flags.UseSitemap, "sitemap", base.UseSitemap, "also seed from /sitemap.xml of every seed host")
+	fs.BoolVar(&flags.RecordAllLinks, "record-links", base.RecordAllLinks, "store every outbound link of a page, including ones that are not crawled")
+	fs.StringVar(&trackingParams, "tracking-params", strings.Join(base.TrackingParams, ","), "comma-separated query parameters to strip from URLs; a trailing * matches a prefix")
+	fs.StringVar(&contentTypes, "content-types", strings.Join(base.ContentTypes, ","), "comma-separated media types to download; a type/* entry matches a family and an empty list accepts all")
+	fs.Int64Var(&flags.MaxBodyBytes, "max-body-bytes", base.MaxBodyBytes, "largest response body to download")
+	fs.BoolVar(&flags.TruncateBodies, "truncate-bodies", base.TruncateBodies, "keep the first -max-body-bytes of larger bodies instead of failing the fetch")
+	fs.StringVar(&allowedDomains, "domains", strings.Join(base.AllowedDomains, ","), "comma-separated domains to stay within (defaults to the seed hosts)")
+	flags.IncludePatterns, flags.ExcludePatterns = base.IncludePatterns, base.ExcludePatterns
+	fs.Var(&patternList{list: &flags.IncludePatterns}, "include", "only crawl URLs matching this regular expression (repeatable)")
+	fs.Var(&patternList{list: &flags.ExcludePatterns}, "exclude", "skip URLs matching this regular expression (repeatable)")
+	fs.BoolVar(&flags.AllowSubdomains, "subdomains", base.AllowSubdomains, "also crawl subdomains of the allowed domains")
+	fs.DurationVar(&flags.HTTPTimeout, "http-timeout", base.HTTPTimeout, "timeout for a single HTTP request, including reading the body")
+	fs.IntVar(&flags.MaxIdleConns, "max-idle-conns", base.MaxIdleConns, "maximum idle connections kept in the shared pool")
+	fs.DurationVar(&flags.IdleConnTimeout, "idle-conn-timeout", base.IdleConnTimeout, "how long an idle pooled connection is kept open")
+	fs.StringVar(&flags.ProxyURL, "proxy", base.ProxyURL, "http://, https:// or socks5:// proxy for all requests (defaults to HTTP_PROXY/HTTPS_PROXY)")
+	fs.StringVar(&flags.LogLevel, "log-level", base.LogLevel, "log level: debug, info, warn or error")
+	fs.IntVar(&maxURLLength, "max-url-length", int(base.MaxURLLength), "drop URLs longer than this many bytes as likely crawler traps")
+	fs.IntVar(&maxSegments, "max-path-segments", int(base.MaxPathSegments), "drop URLs with more path segments than this as likely crawler traps")
+	fs.IntVar(&maxRepeats, "max-segment-repeats", int(base.MaxSegmentRepeats), "drop URLs repeating a path segment more often than this as likely crawler traps")
+	fs.StringVar(&flags.BasicAuthUser, "auth-user", base.BasicAuthUser, "HTTP basic auth user name")
+	fs.StringVar(&flags.BasicAuthPass, "auth-pass", base.BasicAuthPass, "HTTP basic auth password")
+	fs.StringVar(&flags.BearerToken, "bearer-token", base.BearerToken, "bearer token sent in the Authorization header")
+	fs.StringVar(&authHosts, "auth-hosts", strings.Join(base.AuthHosts, ","), "comma-separated hosts to send credentials to; *.example.com matches subdomains (defaults to the seed hosts)")
+	fs.BoolVar(&flags.EnableCookies, "cookies", base.EnableCookies, "keep cookies set by responses and send them on later requests")
+	fs.StringVar(&flags.CookieFile, "cookie-file", base.CookieFile, "Netscape-format cookies.txt to load initial cookies from (implies -cookies)")
+	flags.Headers = base.Headers
+	fs.Var(&headerList{headers: &flags.Headers}, "header", `header sent with every request, as "Name: value" (repeatable; overrides -user-agent)`)
+	fs.StringVar(&flags.UserAgent, "user-agent", base.UserAgent, "User-Agent header sent with every request")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUsage, err)
+	}
+
+	flags.SeedUrls = append(splitList(seeds), fs.Args()...)
+	flags.TrackingParams = splitList(trackingParams)
+	flags.AllowedDomains = splitList(allowedDomains)
+	flags.ContentTypes = splitList(contentTypes)
+	flags.AuthHosts = splitList(authHosts)
+	flags.NumWorkers = int32(numWorkers)
+	flags.MaxPerHost = int32(maxPerHost)
+	flags.MaxDepth = int32(maxDepth)
+	flags.MaxPages = int32(maxPages)
+	flags.MaxRetries = int32(maxRetries)
+	flags.MaxRedirects = int32(maxRedirects)
+	flags.Burst = int32(burst)
+	flags.BatchSize = int32(batchSize)
+	flags.MaxURLLength = int32(maxURLLength)
+	flags.MaxPathSegments = int32(maxSegments)
+	flags.MaxSegmentRepeats = int32(maxRepeats)
+	flags.BreakerThreshold = int32(breakerThreshold)
+	return flags, nil
+}
+
+// configPath finds the value of -config in args ahead of the real parse, so
+// the file can supply the defaults of every other flag.
+func configPath(args []string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if name != "config" {
+			continue
+		}
+		if hasValue {
+			return value
+		}
+		if i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+// patternList is a repeatable flag collecting regular expressions. Its
+// first use replaces the values inherited from the config file; commas are
+// part of the pattern, not separators.
+type patternList struct {
+	list *[]string
+	set  bool
+}
+
+func (p *patternList) String() string {
+	if p.list == nil {
+		return ""
+	}
+	return strings.Join(*p.list, " ")
+}
+
+func (p *patternList) Set(value string) error {
+	if !p.set {
+		*p.list, p.set = nil, true
+	}
+	*p.list = append(*p.list, value)
+	return nil
+}
+
+// headerList is a repeatable flag collecting "Name: value" headers. Its
+// first use replaces the headers inherited from the config file.
+type headerList struct {
+	headers *map[string]string
+	set     bool
+}
+
+func (h *headerList) String() string {
+	if h.headers == nil {
+		return ""
+	}
+	pairs := make([]string, 0, len(*h.headers))
+	for name, value := range *h.headers {
+		pairs = append(pairs, name+": "+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ", ")
+}
+
+func (h *headerList) Set(value string) error {
+	name, val, ok := strings.Cut(value, ":")
+	if !ok || strings.TrimSpace(name) == "" {
+		return fmt.Errorf("header %q is not of the form \"Name: value\"", value)
+	}
+	if !h.set {
+		*h.headers, h.set = make(map[string]string), true
+	}
+	(*h.headers)[strings.TrimSpace(name)] = strings.TrimSpace(val)
+	return nil
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries. It
+// never returns nil so an explicitly empty flag is distinguishable from an
+// unset config field.
+func splitList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"crawler/cli"
+	"crawler/config"
+	"crawler/fetcher"
+	"crawler/storage"
+)
+
+// checkTimeout bounds the DNS lookups made by the check command.
+const checkTimeout = 30 * time.Second
+
+// runCheck validates the configuration given by args, resolves the seed
+// hosts and allowed domains, starts the headless browser if one is
+// configured and checks every job's storage, without crawling. Every
+// problem found is written to w together. As for a crawl, the exit code is
+// 2 when the flags or the configuration are invalid and 1 when only the
+// checks fail.
+func runCheck(args []string, w io.Writer) int {
+	flags, err := cli.ParseFlags(args)
+	if err != nil {
+		if !errors.Is(err, cli.ErrUsage) {
+			printProblems(w, "invalid configuration", err)
+		}
+		return 2
+	}
+	cfg, cfgErr := config.NewConfigManager(flags)
+	errs := []error{cfgErr}
+
+	ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+	defer cancel()
+	errs = append(errs, config.CheckHosts(ctx, cfg)...)
+	if cfg.Fetcher == fetcher.FetcherHeadless {
+		if browser, err := fetcher.NewHeadlessFetcher(cfg); err != nil {
+			errs = append(errs, err)
+		} else {
+			browser.Close()
+		}
+	}
+	if !cfg.DryRun {
+		for _, job := range buildJobs(cfg) {
+			// A malformed connection string is already a configuration
+			// error.
+			if config.ValidateConnString(job.Config.DBConnectionString) != nil {
+				continue
+			}
+			if err := storage.Check(job.Config); err != nil {
+				if job.ID != "" {
+					err = fmt.Errorf("job %s: %w", job.ID, err)
+				}
+				errs = append(errs, err)
+			}
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		printProblems(w, "check failed", err)
+		if cfgErr != nil {
+			return 2
+		}
+		return 1
+	}
+	fmt.Fprintln(w, "configuration ok")
+	return 0
+}
+
+// printProblems writes each error joined in err, however deeply, on its own
+// line after prefix.
+func printProblems(w io.Writer, prefix string, err error) {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, err := range joined.Unwrap() {
+			printProblems(w, prefix, err)
+		}
+		return
+	}
+	fmt.Fprintf(w, "%s: %v\n", prefix, err)
+}
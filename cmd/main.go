@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"crawler"
+	"crawler/cli"
+	"crawler/common"
+	"crawler/config"
+	"crawler/control"
+	"crawler/metrics"
+	"crawler/storage"
+)
+
+// main crawls as configured by its flags. The subcommands "version", which
+// prints the build, and "check", which validates the flags without
+// crawling, may come first instead.
+func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "version", "-version", "--version":
+			printVersion(os.Stdout)
+			return
+		case "check":
+			os.Exit(runCheck(os.Args[2:], os.Stderr))
+		}
+	}
+	os.Exit(runCrawl(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// runCrawl crawls as configured by args and returns the exit code. The
+// configuration is validated and every job's storage opened before any
+// page is fetched. Configuration problems are written to stderr and, in a
+// dry run, the URLs discovered to stdout.
+func runCrawl(args []string, stdout, stderr io.Writer) int {
+	flags, err := cli.ParseFlags(args)
+	if err != nil {
+		if !errors.Is(err, cli.ErrUsage) {
+			printProblems(stderr, "invalid configuration", err)
+		}
+		return 2
+	}
+	cfg, err := config.NewConfigManager(flags)
+	if err != nil {
+		printProblems(stderr, "invalid configuration", err)
+		return 2
+	}
+	log := cfg.Log()
+	log.Info("starting crawl", "config", cfg)
+
+	jobs := buildJobs(cfg)
+	defer closeStorage(jobs, log)
+	if !cfg.DryRun {
+		for i := range jobs {
+			if jobs[i].Storage, err = storage.New(jobs[i].Config); err != nil {
+				log.Error("opening storage failed", "job", jobs[i].ID, "error", err)
+				return 1
+			}
+		}
+	}
+	c, err := crawler.NewJobCrawler(cfg, jobs)
+	if err != nil {
+		log.Error("preparing crawl failed", "error", err)
+		return 1
+	}
+	metricsServer := metrics.StartServer(cfg.MetricsPort, log)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	controlServer := control.StartServer(cfg.ControlHost, cfg.ControlPort, c, log)
+	go handleSignals(cfg, c, cancel)
+	if cfg.DryRun {
+		c.OnDiscover(discoveredPrinter(stdout))
+	}
+	crawlErr := c.Start(ctx)
+	if crawlErr != nil {
+		log.Warn("crawl stopped", "error", crawlErr)
+	}
+
+	closeStorage(jobs, log)
+	stopCtx, stop := context.WithTimeout(context.Background(), 5*time.Second)
+	defer stop()
+	if err := metricsServer.Shutdown(stopCtx); err != nil {
+		log.Error("stopping metrics server failed", "error", err)
+	}
+	if err := controlServer.Shutdown(stopCtx); err != nil {
+		log.Error("stopping control server failed", "error", err)
+	}
+
+	stats := c.Stats()
+	log.Info("crawl finished",
+		"fetched", stats.PagesFetched,
+		"stored", stats.PagesStored,
+		"errors", stats.Errors,
+		"bytes", stats.BytesDownloaded,
+		"hosts", stats.UniqueHosts,
+		"disallowed", stats.Disallowed,
+		"rejected", stats.Rejected,
+		"trapped", stats.Trapped,
+		"duration", stats.Duration.Round(time.Millisecond),
+		"pages_per_sec", fmt.Sprintf("%.1f", stats.PagesPerSecond))
+	if crawlErr != nil {
+		return 1
+	}
+	return 0
+}
+
+// closeStorage closes the storage opened for jobs and forgets it, so it is
+// closed once however often closeStorage is called.
+func closeStorage(jobs []crawler.Job, log *slog.Logger) {
+	for i, job := range jobs {
+		if job.Storage == nil {
+			continue
+		}
+		if err := job.Storage.Close(); err != nil {
+			log.Error("closing storage failed", "job", job.ID, "error", err)
+		}
+		jobs[i].Storage = nil
+	}
+}
+
+// buildJobs returns the jobs of cfg, or a single job crawling cfg itself when
+// it has none. Storage is left for the caller to open.
+func buildJobs(cfg *common.ConfigManager) []crawler.Job {
+	if len(cfg.Jobs) == 0 {
+		return []crawler.Job{{Config: cfg}}
+	}
+	jobs := make([]crawler.Job, 0, len(cfg.Jobs))
+	for _, job := range cfg.Jobs {
+		jobs = append(jobs, crawler.Job{ID: job.ID, Config: config.ForJob(cfg, job)})
+	}
+	return jobs
+}
+
+// discoveredPrinter returns an OnDiscover hook writing every URL enqueued
+// to w, one per line and preceded by its job ID in a multi-job crawl.
+func discoveredPrinter(w io.Writer) func(jobID, pageURL string, depth int) {
+	var mu sync.Mutex
+	return func(jobID, pageURL string, depth int) {
+		mu.Lock()
+		defer mu.Unlock()
+		if jobID != "" {
+			fmt.Fprintf(w, "%s\t%s\n", jobID, pageURL)
+		} else {
+			fmt.Fprintln(w, pageURL)
+		}
+	}
+}
+
+// handleSignals starts a graceful shutdown on the first SIGINT or SIGTERM:
+// workers stop taking new URLs and main saves state and closes storage once
+// the in-flight ones finish. A second signal exits immediately. In-flight
+// work outlasting cfg.ShutdownTimeout is cancelled, which makes Start
+// return so main can still save and close; if that too takes longer than
+// cfg.ShutdownTimeout the process exits without it.
+func handleSignals(cfg *common.ConfigManager, c *crawler.Crawler, cancel context.CancelFunc) {
+	log := cfg.Log()
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+
+	sig := <-sigs
+	log.Info("shutting down; send the signal again to force exit", "signal", sig.String())
+	c.Shutdown()
+
+	select {
+	case <-sigs:
+		log.Warn("forced exit")
+		os.Exit(1)
+	case <-time.After(cfg.ShutdownTimeout):
+		log.Error("in-flight work did not finish in time, cancelling it", "timeout", cfg.ShutdownTimeout)
+		cancel()
+	}
+	select {
+	case <-sigs:
+		log.Warn("forced exit")
+	case <-time.After(cfg.ShutdownTimeout):
+		log.Error("saving state and closing storage did not finish in time, exiting", "timeout", cfg.ShutdownTimeout)
+	}
+	os.Exit(1)
+}
@@ -0,0 +1,30 @@
+package common
+
+import "context"
+
+// Storage persists crawled pages. Implementations must be safe for
+// concurrent use by multiple workers.
+type Storage interface {
+	Save(ctx context.Context, data PageStorageData) error
+	Close() error
+}
+
+// BatchStorage is implemented by storages that can write several pages in
+// one round trip.
+type BatchStorage interface {
+	Storage
+	SaveBatch(ctx context.Context, batch []PageStorageData) error
+}
+
+// ValidatorStorage is implemented by storages that can return the HTTP
+// cache validators saved with a page, so recrawls can make conditional
+// requests. Both are empty when the page is not stored.
+type ValidatorStorage interface {
+	Validators(ctx context.Context, url string) (etag, lastModified string, err error)
+}
+
+// AliasStorage is implemented by storages that can record a URL whose
+// content is already stored under another URL.
+type AliasStorage interface {
+	SaveAlias(ctx context.Context, alias, original string) error
+}
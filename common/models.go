@@ -1,44 +1,219 @@
 package common
 
 import (
-	"sync"
+	"log/slog"
 	"time"
 )
 
 type CLIFlags struct {
-	seedUrls           []string
-	numWorkers         int32
-	crawlDelay         time.Duration
+	ConfigFile         string
+	SeedUrls           []string
+	SeedFile           string
+	NumWorkers         int32
+	CrawlDelay         time.Duration
 	DBConnectionString string
-	userAgent          string
+	UserAgent          string
+	MaxPerHost         int32
+	MaxDepth           int32
+	MaxPages           int32
+	StateFile          string
+	CheckpointInterval time.Duration
+	StorageType        string
+	OutputFormat       string
+	OutputPath         string
+	MaxRetries         int32
+	BaseBackoff        time.Duration
+	MetricsPort        int
+	ControlPort        int
+	ControlHost        string
+	ShutdownTimeout    time.Duration
+	TrackingParams     []string
+	AllowedDomains     []string
+	AllowSubdomains    bool
+	HTTPTimeout        time.Duration
+	MaxIdleConns       int
+	IdleConnTimeout    time.Duration
+	RequestsPerSecond  float64
+	Burst              int32
+	UseSitemap         bool
+	RecordAllLinks     bool
+	ProxyURL           string
+	LogLevel           string
+	MaxURLLength       int32
+	MaxPathSegments    int32
+	MaxSegmentRepeats  int32
+	MaxRedirects       int32
+	IncludePatterns    []string
+	ExcludePatterns    []string
+	ContentTypes       []string
+	MaxBodyBytes       int64
+	TruncateBodies     bool
+	DryRun             bool
+	BatchSize          int32
+	FlushInterval      time.Duration
+	Headers            map[string]string
+	EnableCookies      bool
+	CookieFile         string
+	AdaptiveDelay      bool
+	MinDelay           time.Duration
+	MaxDelay           time.Duration
+	DelayFactor        float64
+	BreakerThreshold   int32
+	BreakerCooldown    time.Duration
+	BasicAuthUser      string
+	BasicAuthPass      string
+	BearerToken        string
+	AuthHosts          []string
+	VisitedSet         string
+	BloomExpectedURLs  int64
+	BloomFPRate        float64
+	Frontier           string
+	FrontierPath       string
+	Fetcher            string
+	Jobs               []JobConfig
 }
 
+// ConfigManager is the resolved runtime configuration. The yaml tags name the
+// keys accepted in config files loaded by config.LoadConfig.
 type ConfigManager struct {
-	seedUrls           []string
-	numWorkers         int32
-	crawlDelay         time.Duration
-	DBConnectionString string
-	userAgent          string
+	SeedUrls           []string      `yaml:"seed_urls"`
+	SeedFile           string        `yaml:"seed_file"`
+	NumWorkers         int32         `yaml:"num_workers"`
+	CrawlDelay         time.Duration `yaml:"crawl_delay"`
+	DBConnectionString string        `yaml:"db_connection_string"`
+	UserAgent          string        `yaml:"user_agent"`
+	MaxPerHost         int32         `yaml:"max_per_host"`
+	MaxDepth           int32         `yaml:"max_depth"`
+	MaxPages           int32         `yaml:"max_pages"` // per job; 0 for unlimited
+	StateFile          string        `yaml:"state_file"`
+	CheckpointInterval time.Duration `yaml:"checkpoint_interval"`
+	StorageType        string        `yaml:"storage_type"`
+	OutputFormat       string        `yaml:"output_format"`
+	OutputPath         string        `yaml:"output_path"`
+	MaxRetries         int32         `yaml:"max_retries"`
+	BaseBackoff        time.Duration `yaml:"base_backoff"`
+	MetricsPort        int           `yaml:"metrics_port"`
+	ControlPort        int           `yaml:"control_port"`
+	ControlHost        string        `yaml:"control_host"`
+	ShutdownTimeout    time.Duration `yaml:"shutdown_timeout"`
+	TrackingParams     []string      `yaml:"tracking_params"`
+	AllowedDomains     []string      `yaml:"allowed_domains"`
+	AllowSubdomains    bool          `yaml:"allow_subdomains"`
+	HTTPTimeout        time.Duration `yaml:"http_timeout"`
+	MaxIdleConns       int           `yaml:"max_idle_conns"`
+	IdleConnTimeout    time.Duration `yaml:"idle_conn_timeout"`
+	RequestsPerSecond  float64       `yaml:"requests_per_second"`
+	Burst              int32         `yaml:"burst"`
+	UseSitemap         bool          `yaml:"use_sitemap"`
+	RecordAllLinks     bool          `yaml:"record_all_links"`
+	ProxyURL           string        `yaml:"proxy_url"`
+	LogLevel           string        `yaml:"log_level"`
+	MaxURLLength       int32         `yaml:"max_url_length"`
+	MaxPathSegments    int32         `yaml:"max_path_segments"`
+	MaxSegmentRepeats  int32         `yaml:"max_segment_repeats"`
+	MaxRedirects       int32         `yaml:"max_redirects"` // -1 follows none
+	IncludePatterns    []string      `yaml:"include_patterns"`
+	ExcludePatterns    []string      `yaml:"exclude_patterns"`
+	ContentTypes       []string      `yaml:"allowed_content_types"`
+	MaxBodyBytes       int64         `yaml:"max_body_bytes"`
+	TruncateBodies     bool          `yaml:"truncate_bodies"`
+	DryRun             bool          `yaml:"dry_run"`
+	BatchSize          int32         `yaml:"batch_size"`
+	FlushInterval      time.Duration `yaml:"flush_interval"`
+	// Headers are sent with every request. A User-Agent entry overrides
+	// UserAgent.
+	Headers map[string]string `yaml:"headers"`
+	// EnableCookies keeps cookies set by responses for later requests. A
+	// CookieFile, in Netscape format, seeds the jar and implies it.
+	EnableCookies bool   `yaml:"enable_cookies"`
+	CookieFile    string `yaml:"cookie_file"`
+	// AdaptiveDelay replaces CrawlDelay with a per-host delay of
+	// DelayFactor times the host's last response latency, clamped to
+	// [MinDelay, MaxDelay].
+	AdaptiveDelay bool          `yaml:"adaptive_delay"`
+	MinDelay      time.Duration `yaml:"min_delay"`
+	MaxDelay      time.Duration `yaml:"max_delay"`
+	DelayFactor   float64       `yaml:"delay_factor"`
+	// After BreakerThreshold consecutive failures of a host, such as 5xx
+	// responses or DNS errors, its URLs are held back for BreakerCooldown
+	// before one probe is let through. A threshold of 0 disables this.
+	BreakerThreshold int32         `yaml:"breaker_threshold"`
+	BreakerCooldown  time.Duration `yaml:"breaker_cooldown"`
+	// Credentials are sent only to hosts matching AuthHosts, which default
+	// to the seed hosts. They are never logged.
+	BasicAuthUser string   `yaml:"basic_auth_user"`
+	BasicAuthPass string   `yaml:"basic_auth_pass"`
+	BearerToken   string   `yaml:"bearer_token"`
+	AuthHosts     []string `yaml:"auth_hosts"`
+	// VisitedSet is "map" for an exact visited set or "bloom" for a
+	// fixed-size bloom filter sized by BloomExpectedURLs and BloomFPRate.
+	VisitedSet        string  `yaml:"visited_set"`
+	BloomExpectedURLs int64   `yaml:"bloom_expected_urls"`
+	BloomFPRate       float64 `yaml:"bloom_fp_rate"`
+	// Frontier is "memory" to queue URLs in memory or "disk" to queue them
+	// in the BoltDB file at FrontierPath, which survives restarts when used
+	// with StateFile.
+	Frontier     string `yaml:"frontier"`
+	FrontierPath string `yaml:"frontier_path"`
+	// Fetcher is "http" to download pages directly or "headless" to load
+	// them in headless Chrome and store the HTML their scripts render. The
+	// crawl falls back to http if Chrome cannot be started.
+	Fetcher string `yaml:"fetcher"`
+	// Jobs, when set, replace SeedUrls with several independent crawls
+	// that share the workers and rate limit. They can only be given in a
+	// config file.
+	Jobs []JobConfig `yaml:"jobs"`
+
+	// Logger receives every log line of the crawl. NewConfigManager sets it
+	// from LogLevel; embedders may inject their own.
+	Logger *slog.Logger `yaml:"-"`
+	// Priority ranks queued URLs; higher values are crawled first. When nil
+	// the crawl is breadth-first.
+	Priority func(url string, depth int) int `yaml:"-"`
 }
 
-type FetchedPageData struct {
-	URL   string
-	body  []byte
-	error error
+// JobConfig describes one crawl in a multi-job run. Its seeds, domain rules
+// and filters replace the top-level ones. MaxDepth, output and state file
+// fall back to the top-level settings when unset, with file names made
+// unique to the job.
+type JobConfig struct {
+	ID              string   `yaml:"id"`
+	SeedUrls        []string `yaml:"seed_urls"`
+	AllowedDomains  []string `yaml:"allowed_domains"`
+	AllowSubdomains bool     `yaml:"allow_subdomains"`
+	IncludePatterns []string `yaml:"include_patterns"`
+	ExcludePatterns []string `yaml:"exclude_patterns"`
+	MaxDepth        int32    `yaml:"max_depth"`
+	OutputFormat    string   `yaml:"output_format"`
+	OutputPath      string   `yaml:"output_path"`
+	StateFile       string   `yaml:"state_file"`
 }
 
-type PageStorageData struct {
-	URL   string
-	title string
-	error error
+type FetchedPageData struct {
+	URL          string
+	FinalURL     string // where URL led after following redirects
+	StatusCode   int
+	Body         []byte
+	ETag         string
+	LastModified string
+	Language     string // Content-Language header
+	// Latency is how long the last attempt took to get response headers,
+	// not counting retries or the body download. Zero if none arrived.
+	Latency time.Duration
+	Err     error // the fetch error, set by the crawler for hooks
 }
 
-type UrlManager struct {
-	mu              sync.Mutex
-	queue           []string
-	visited         map[string]bool
-	urlChannel      chan string
-	activeWorkers   sync.WaitGroup
-	shutDownChannel chan struct{}
-	done            bool
+type PageStorageData struct {
+	URL          string
+	Title        string
+	Description  string
+	CanonicalURL string
+	LinkCount    int
+	ContentHash  string
+	ETag         string
+	LastModified string
+	Language     string   // BCP-47 tag, empty when unknown
+	Links        []string // every outbound link, set only with RecordAllLinks
+	JobID        string   // job the page was crawled for, empty without jobs
+	Err          error
 }
@@ -0,0 +1,284 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// robotsMaxBytes caps how much of a robots.txt file we read.
+const robotsMaxBytes = 512 * 1024
+
+// RobotsManager fetches, parses and caches robots.txt rules per host.
+type RobotsManager struct {
+	mu        sync.Mutex
+	client    *http.Client
+	userAgent string
+	hosts     map[string]*robotsEntry
+}
+
+// robotsEntry holds a host's rules, nil until its robots.txt has been
+// fetched.
+type robotsEntry struct {
+	mu    sync.Mutex
+	rules *robotsRules
+}
+
+type robotsRule struct {
+	pattern string
+	allow   bool
+}
+
+type robotsRules struct {
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+func NewRobotsManager(client *http.Client, userAgent string) *RobotsManager {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &RobotsManager{
+		client:    client,
+		userAgent: userAgent,
+		hosts:     make(map[string]*robotsEntry),
+	}
+}
+
+// IsAllowed reports whether our user agent may fetch rawURL, fetching the
+// host's robots.txt with ctx the first time. Unparseable URLs are never
+// allowed.
+func (rm *RobotsManager) IsAllowed(ctx context.Context, rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	return rm.rulesFor(ctx, u).allows(path)
+}
+
+// CrawlDelay returns the Crawl-delay declared for host, or zero if the host
+// declared none or its robots.txt has not been fetched yet.
+func (rm *RobotsManager) CrawlDelay(host string) time.Duration {
+	rm.mu.Lock()
+	entry, ok := rm.hosts[strings.ToLower(host)]
+	rm.mu.Unlock()
+	if !ok {
+		return 0
+	}
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	if entry.rules == nil {
+		return 0
+	}
+	return entry.rules.crawlDelay
+}
+
+// rulesFor returns the rules of u's host, fetching them on first use. A
+// fetch cut short by ctx allows everything but is not cached, so the file
+// is fetched again next time.
+func (rm *RobotsManager) rulesFor(ctx context.Context, u *url.URL) *robotsRules {
+	host := strings.ToLower(u.Host)
+	rm.mu.Lock()
+	entry, ok := rm.hosts[host]
+	if !ok {
+		entry = &robotsEntry{}
+		rm.hosts[host] = entry
+	}
+	rm.mu.Unlock()
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	if entry.rules != nil {
+		return entry.rules
+	}
+	rules := rm.fetch(ctx, u.Scheme+"://"+u.Host+"/robots.txt")
+	if ctx.Err() == nil {
+		entry.rules = rules
+	}
+	return rules
+}
+
+// fetch downloads and parses a robots.txt file. Any failure, including a
+// missing file or a timeout, results in an empty rule set that allows all.
+func (rm *RobotsManager) fetch(ctx context.Context, robotsURL string) *robotsRules {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, robotsURL, nil)
+	if err != nil {
+		return &robotsRules{}
+	}
+	if rm.userAgent != "" {
+		req.Header.Set("User-Agent", rm.userAgent)
+	}
+	resp, err := rm.client.Do(req)
+	if err != nil {
+		return &robotsRules{}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return &robotsRules{}
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, robotsMaxBytes))
+	if err != nil {
+		return &robotsRules{}
+	}
+	return parseRobots(body, rm.userAgent)
+}
+
+// parseRobots extracts the rules of the groups that best match userAgent,
+// falling back to the "*" groups. Groups naming the same agent are merged,
+// as if they had been written as one.
+func parseRobots(body []byte, userAgent string) *robotsRules {
+	token := strings.ToLower(userAgent)
+	if i := strings.IndexAny(token, "/ "); i >= 0 {
+		token = token[:i]
+	}
+
+	var (
+		specific, wildcard *robotsRules
+		groupAgents        []string
+		groupRules         *robotsRules
+		inRules            bool
+	)
+	flush := func() {
+		if groupRules == nil {
+			return
+		}
+		var isSpecific, isWildcard bool
+		for _, agent := range groupAgents {
+			if agent == "*" {
+				isWildcard = true
+			} else if token != "" && strings.Contains(token, agent) {
+				isSpecific = true
+			}
+		}
+		if isSpecific {
+			specific = specific.merge(groupRules)
+		}
+		if isWildcard {
+			wildcard = wildcard.merge(groupRules)
+		}
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			if value == "" {
+				// An empty agent would match every token.
+				continue
+			}
+			if inRules {
+				flush()
+				groupAgents, groupRules, inRules = nil, nil, false
+			}
+			if groupRules == nil {
+				groupRules = &robotsRules{}
+			}
+			groupAgents = append(groupAgents, strings.ToLower(value))
+		case "allow", "disallow":
+			if groupRules == nil {
+				continue
+			}
+			inRules = true
+			if value == "" {
+				// An empty Disallow means allow everything.
+				continue
+			}
+			groupRules.rules = append(groupRules.rules, robotsRule{pattern: value, allow: key == "allow"})
+		case "crawl-delay":
+			if groupRules == nil {
+				continue
+			}
+			inRules = true
+			if secs, err := strconv.ParseFloat(value, 64); err == nil && secs > 0 {
+				groupRules.crawlDelay = time.Duration(secs * float64(time.Second))
+			}
+		}
+	}
+	flush()
+
+	if specific != nil {
+		return specific
+	}
+	if wildcard != nil {
+		return wildcard
+	}
+	return &robotsRules{}
+}
+
+// merge returns r with the rules of g added, allocating r if it is nil. The
+// first Crawl-delay declared wins.
+func (r *robotsRules) merge(g *robotsRules) *robotsRules {
+	if r == nil {
+		r = &robotsRules{}
+	}
+	r.rules = append(r.rules, g.rules...)
+	if r.crawlDelay == 0 {
+		r.crawlDelay = g.crawlDelay
+	}
+	return r
+}
+
+// allows applies the longest matching rule; Allow wins ties.
+func (r *robotsRules) allows(path string) bool {
+	best, allowed := -1, true
+	for _, rule := range r.rules {
+		if !robotsMatch(rule.pattern, path) {
+			continue
+		}
+		n := len(rule.pattern)
+		if n > best || (n == best && rule.allow) {
+			best, allowed = n, rule.allow
+		}
+	}
+	return allowed
+}
+
+// robotsMatch matches path against a robots.txt pattern supporting the "*"
+// wildcard and the "$" end anchor.
+func robotsMatch(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	if anchored {
+		pattern = strings.TrimSuffix(pattern, "$")
+	}
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	rest := path[len(parts[0]):]
+	for i, part := range parts[1:] {
+		if anchored && i == len(parts)-2 {
+			return strings.HasSuffix(rest, part)
+		}
+		j := strings.Index(rest, part)
+		if j < 0 {
+			return false
+		}
+		rest = rest[j+len(part):]
+	}
+	return !anchored || rest == ""
+}
@@ -0,0 +1,172 @@
+package common
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testAgent = "webCrawler/0.1"
+
+func TestParseRobotsGroupSelection(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		path string
+		want bool
+	}{
+		{
+			name: "specific group wins over *",
+			body: "User-agent: *\nDisallow: /\n\nUser-agent: webcrawler\nDisallow: /private\n",
+			path: "/public",
+			want: true,
+		},
+		{
+			name: "falls back to *",
+			body: "User-agent: otherbot\nDisallow: /\n\nUser-agent: *\nDisallow: /private\n",
+			path: "/private/a",
+			want: false,
+		},
+		{
+			name: "no matching group allows everything",
+			body: "User-agent: otherbot\nDisallow: /\n",
+			path: "/",
+			want: true,
+		},
+		{
+			name: "empty agent does not override *",
+			body: "User-agent:\nAllow: /\n\nUser-agent: *\nDisallow: /\n",
+			path: "/page",
+			want: false,
+		},
+		{
+			name: "agents sharing a group",
+			body: "User-agent: otherbot\nUser-agent: webcrawler\nDisallow: /shared\n",
+			path: "/shared/a",
+			want: false,
+		},
+		{
+			name: "repeated groups are merged",
+			body: "User-agent: webcrawler\nDisallow: /a\n\nUser-agent: otherbot\nDisallow: /\n\nUser-agent: webcrawler\nDisallow: /b\n",
+			path: "/b/page",
+			want: false,
+		},
+		{
+			name: "repeated * groups are merged",
+			body: "User-agent: *\nDisallow: /a\n\nUser-agent: *\nDisallow: /b\n",
+			path: "/b/page",
+			want: false,
+		},
+		{
+			name: "comments and case are ignored",
+			body: "# rules\nUSER-AGENT: WebCrawler # us\nDISALLOW: /x\n",
+			path: "/x",
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseRobots([]byte(tt.body), testAgent).allows(tt.path); got != tt.want {
+				t.Errorf("allows(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRobotsRulesAllows(t *testing.T) {
+	body := `User-agent: *
+Disallow: /private
+Allow: /private/open
+Disallow: /tie
+Allow: /tie
+Disallow: /*.pdf$
+Disallow: /search*q=
+Allow: /exact$
+Disallow: /exact
+Disallow:
+`
+	rules := parseRobots([]byte(body), testAgent)
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/", true},
+		{"/private", false},
+		{"/private/secret", false},
+		{"/private/open", true},     // longer Allow wins
+		{"/private/open/doc", true}, // still the longest match
+		{"/tie", true},              // Allow wins a tie
+		{"/files/a.pdf", false},
+		{"/files/a.pdf?x=1", true}, // $ anchors the end
+		{"/search?q=go", false},
+		{"/search?page=2", true},
+		{"/exact", true},
+		{"/exactly", false},
+	}
+	for _, tt := range tests {
+		if got := rules.allows(tt.path); got != tt.want {
+			t.Errorf("allows(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+// robotsServer serves body as /robots.txt with status and counts the
+// requests for it.
+func robotsServer(t *testing.T, status int, body string) (*httptest.Server, *atomic.Int32) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/robots.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		requests.Add(1)
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func TestCrawlDelay(t *testing.T) {
+	srv, _ := robotsServer(t, http.StatusOK, "User-agent: *\nCrawl-delay: 1.5\n\nUser-agent: webcrawler\nCrawl-delay: 2\n")
+	rm := NewRobotsManager(srv.Client(), testAgent)
+	host := srv.Listener.Addr().String()
+	if d := rm.CrawlDelay(host); d != 0 {
+		t.Errorf("CrawlDelay before fetching = %v, want 0", d)
+	}
+	rm.IsAllowed(context.Background(), srv.URL+"/")
+	if d := rm.CrawlDelay(host); d != 2*time.Second {
+		t.Errorf("CrawlDelay = %v, want 2s", d)
+	}
+}
+
+func TestNon200RobotsAllowsEverything(t *testing.T) {
+	for _, status := range []int{http.StatusNotFound, http.StatusForbidden, http.StatusInternalServerError} {
+		srv, _ := robotsServer(t, status, "User-agent: *\nDisallow: /\n")
+		rm := NewRobotsManager(srv.Client(), testAgent)
+		if !rm.IsAllowed(context.Background(), srv.URL+"/page") {
+			t.Errorf("robots.txt answering %d disallowed a page", status)
+		}
+	}
+}
+
+func TestCancelledRobotsFetchNotCached(t *testing.T) {
+	srv, requests := robotsServer(t, http.StatusOK, "User-agent: *\nDisallow: /\n")
+	rm := NewRobotsManager(srv.Client(), testAgent)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if !rm.IsAllowed(ctx, srv.URL+"/page") {
+		t.Error("a cancelled robots.txt fetch disallowed the page")
+	}
+	if rm.IsAllowed(context.Background(), srv.URL+"/page") {
+		t.Error("rules from the cancelled fetch were cached")
+	}
+	rm.IsAllowed(context.Background(), srv.URL+"/other")
+	if n := requests.Load(); n != 1 {
+		t.Errorf("robots.txt fetched %d times after the cancelled attempt, want 1", n)
+	}
+}
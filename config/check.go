@@ -0,0 +1,57 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+
+	"crawler/common"
+)
+
+// CheckHosts resolves the host of every seed URL, of cfg and of each of its
+// jobs, and every allowed domain, returning an error for each one that
+// does not resolve. Allowed domains are skipped when subdomains are allowed,
+// as only their subdomains may have addresses. It is meant as a pre-flight
+// check before a crawl and does not fetch anything.
+func CheckHosts(ctx context.Context, cfg *common.ConfigManager) []error {
+	hosts := make(map[string]bool)
+	addSeeds := func(seeds []string) {
+		for _, seed := range seeds {
+			if u, err := url.Parse(seed); err == nil && u.Hostname() != "" {
+				hosts[strings.ToLower(u.Hostname())] = true
+			}
+		}
+	}
+	addDomains := func(domains []string, subdomains bool) {
+		if subdomains {
+			return
+		}
+		for _, domain := range domains {
+			hosts[strings.ToLower(domain)] = true
+		}
+	}
+	addSeeds(cfg.SeedUrls)
+	addDomains(cfg.AllowedDomains, cfg.AllowSubdomains)
+	for _, job := range cfg.Jobs {
+		addSeeds(job.SeedUrls)
+		addDomains(job.AllowedDomains, job.AllowSubdomains)
+	}
+
+	names := make([]string, 0, len(hosts))
+	for host := range hosts {
+		if net.ParseIP(host) == nil {
+			names = append(names, host)
+		}
+	}
+	sort.Strings(names)
+	var errs []error
+	for _, host := range names {
+		if _, err := net.DefaultResolver.LookupHost(ctx, host); err != nil {
+			errs = append(errs, fmt.Errorf("resolving %s: %w", host, err))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,405 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/textproto"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"crawler/common"
+)
+
+// DefaultTrackingParams are the query parameters stripped during URL
+// normalization. A trailing "*" matches any parameter with that prefix.
+var DefaultTrackingParams = []string{"utm_*", "fbclid", "gclid"}
+
+// DefaultContentTypes are the media types whose bodies are downloaded and
+// parsed.
+var DefaultContentTypes = []string{"text/html"}
+
+const (
+	DefaultNumWorkers       = 4
+	DefaultCrawlDelay       = 500 * time.Millisecond
+	DefaultUserAgent        = "webCrawler/0.1"
+	DefaultMaxPerHost       = 2
+	DefaultStorage          = "postgres"
+	DefaultMaxRetries       = 3
+	DefaultBackoff          = 500 * time.Millisecond
+	DefaultShutdown         = 30 * time.Second
+	DefaultHTTPTimeout      = 30 * time.Second
+	DefaultMaxIdleConns     = 100
+	DefaultIdleConnTimeout  = 90 * time.Second
+	DefaultBurst            = 1
+	DefaultLogLevel         = "info"
+	DefaultMaxURLLength     = 2048
+	DefaultMaxSegments      = 32
+	DefaultMaxRepeats       = 3
+	DefaultMaxRedirects     = 10
+	DefaultMaxBodyBytes     = 10 << 20
+	DefaultBatchSize        = 1
+	DefaultFlushInterval    = time.Second
+	DefaultMinDelay         = 100 * time.Millisecond
+	DefaultMaxDelay         = 10 * time.Second
+	DefaultDelayFactor      = 2.0
+	DefaultVisitedSet       = "map"
+	DefaultBloomExpected    = 10_000_000
+	DefaultBloomFPRate      = 0.001
+	DefaultFrontier         = "memory"
+	DefaultFrontierPath     = "frontier.db"
+	DefaultFetcher          = "http"
+	DefaultBreakerThreshold = 5
+	DefaultBreakerCooldown  = time.Minute
+	DefaultControlHost      = "127.0.0.1"
+)
+
+// NewConfigManager builds the runtime configuration from parsed CLI flags,
+// filling in defaults and validating the result. Every problem found is
+// reported, joined with errors.Join, rather than only the first. The
+// configuration is returned even when invalid, so the check command can
+// report what else is wrong with it; it must not be used to crawl.
+func NewConfigManager(flags *common.CLIFlags) (*common.ConfigManager, error) {
+	cfg := &common.ConfigManager{
+		SeedUrls:           flags.SeedUrls,
+		SeedFile:           flags.SeedFile,
+		NumWorkers:         flags.NumWorkers,
+		CrawlDelay:         flags.CrawlDelay,
+		DBConnectionString: flags.DBConnectionString,
+		UserAgent:          flags.UserAgent,
+		MaxPerHost:         flags.MaxPerHost,
+		MaxDepth:           flags.MaxDepth,
+		MaxPages:           flags.MaxPages,
+		StateFile:          flags.StateFile,
+		CheckpointInterval: flags.CheckpointInterval,
+		StorageType:        flags.StorageType,
+		OutputFormat:       flags.OutputFormat,
+		OutputPath:         flags.OutputPath,
+		MaxRetries:         flags.MaxRetries,
+		BaseBackoff:        flags.BaseBackoff,
+		MetricsPort:        flags.MetricsPort,
+		ControlPort:        flags.ControlPort,
+		ControlHost:        flags.ControlHost,
+		ShutdownTimeout:    flags.ShutdownTimeout,
+		TrackingParams:     flags.TrackingParams,
+		AllowedDomains:     flags.AllowedDomains,
+		AllowSubdomains:    flags.AllowSubdomains,
+		HTTPTimeout:        flags.HTTPTimeout,
+		MaxIdleConns:       flags.MaxIdleConns,
+		IdleConnTimeout:    flags.IdleConnTimeout,
+		RequestsPerSecond:  flags.RequestsPerSecond,
+		Burst:              flags.Burst,
+		UseSitemap:         flags.UseSitemap,
+		RecordAllLinks:     flags.RecordAllLinks,
+		ProxyURL:           flags.ProxyURL,
+		LogLevel:           flags.LogLevel,
+		MaxURLLength:       flags.MaxURLLength,
+		MaxPathSegments:    flags.MaxPathSegments,
+		MaxSegmentRepeats:  flags.MaxSegmentRepeats,
+		MaxRedirects:       flags.MaxRedirects,
+		IncludePatterns:    flags.IncludePatterns,
+		ExcludePatterns:    flags.ExcludePatterns,
+		ContentTypes:       flags.ContentTypes,
+		MaxBodyBytes:       flags.MaxBodyBytes,
+		TruncateBodies:     flags.TruncateBodies,
+		DryRun:             flags.DryRun,
+		BatchSize:          flags.BatchSize,
+		FlushInterval:      flags.FlushInterval,
+		Headers:            flags.Headers,
+		EnableCookies:      flags.EnableCookies,
+		CookieFile:         flags.CookieFile,
+		AdaptiveDelay:      flags.AdaptiveDelay,
+		MinDelay:           flags.MinDelay,
+		MaxDelay:           flags.MaxDelay,
+		DelayFactor:        flags.DelayFactor,
+		BreakerThreshold:   flags.BreakerThreshold,
+		BreakerCooldown:    flags.BreakerCooldown,
+		BasicAuthUser:      flags.BasicAuthUser,
+		BasicAuthPass:      flags.BasicAuthPass,
+		BearerToken:        flags.BearerToken,
+		AuthHosts:          flags.AuthHosts,
+		VisitedSet:         flags.VisitedSet,
+		BloomExpectedURLs:  flags.BloomExpectedURLs,
+		BloomFPRate:        flags.BloomFPRate,
+		Frontier:           flags.Frontier,
+		FrontierPath:       flags.FrontierPath,
+		Fetcher:            flags.Fetcher,
+		Jobs:               flags.Jobs,
+	}
+	var errs []error
+	if cfg.NumWorkers <= 0 {
+		cfg.NumWorkers = DefaultNumWorkers
+	}
+	if cfg.CrawlDelay < 0 {
+		cfg.CrawlDelay = DefaultCrawlDelay
+	}
+	if cfg.MinDelay < 0 {
+		cfg.MinDelay = 0
+	}
+	if cfg.MaxDelay <= 0 {
+		cfg.MaxDelay = DefaultMaxDelay
+	}
+	if cfg.MaxDelay < cfg.MinDelay {
+		errs = append(errs, fmt.Errorf("max delay %s is below min delay %s", cfg.MaxDelay, cfg.MinDelay))
+	}
+	if cfg.DelayFactor <= 0 {
+		cfg.DelayFactor = DefaultDelayFactor
+	}
+	if cfg.BreakerThreshold < 0 {
+		cfg.BreakerThreshold = 0
+	}
+	if cfg.BreakerCooldown <= 0 {
+		cfg.BreakerCooldown = DefaultBreakerCooldown
+	}
+	if cfg.MaxPerHost < 0 {
+		// Zero sets no per-host limit, so only a negative value is wrong.
+		errs = append(errs, fmt.Errorf("invalid max per host %d", cfg.MaxPerHost))
+	}
+	if cfg.MaxDepth < 0 {
+		cfg.MaxDepth = 0
+	}
+	if cfg.MaxPages < 0 {
+		cfg.MaxPages = 0
+	}
+	if cfg.CheckpointInterval < 0 {
+		cfg.CheckpointInterval = 0
+	}
+	switch cfg.VisitedSet {
+	case "":
+		cfg.VisitedSet = DefaultVisitedSet
+	case "map", "bloom":
+	default:
+		errs = append(errs, fmt.Errorf("unknown visited set %q", cfg.VisitedSet))
+	}
+	if cfg.BloomExpectedURLs <= 0 {
+		cfg.BloomExpectedURLs = DefaultBloomExpected
+	}
+	if cfg.BloomFPRate <= 0 || cfg.BloomFPRate >= 1 {
+		cfg.BloomFPRate = DefaultBloomFPRate
+	}
+	switch cfg.Frontier {
+	case "":
+		cfg.Frontier = DefaultFrontier
+	case "memory", "disk":
+	default:
+		errs = append(errs, fmt.Errorf("unknown frontier %q", cfg.Frontier))
+	}
+	if cfg.FrontierPath == "" {
+		cfg.FrontierPath = DefaultFrontierPath
+	}
+	switch cfg.Fetcher {
+	case "":
+		cfg.Fetcher = DefaultFetcher
+	case "http", "headless":
+	default:
+		errs = append(errs, fmt.Errorf("unknown fetcher %q", cfg.Fetcher))
+	}
+	if cfg.StorageType == "" {
+		cfg.StorageType = DefaultStorage
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultBatchSize
+	}
+	if cfg.FlushInterval < 0 {
+		cfg.FlushInterval = 0
+	}
+	if cfg.MaxRetries < 0 {
+		cfg.MaxRetries = 0
+	}
+	switch {
+	case cfg.MaxRedirects == 0:
+		cfg.MaxRedirects = DefaultMaxRedirects
+	case cfg.MaxRedirects < 0:
+		cfg.MaxRedirects = 0
+	}
+	if cfg.BaseBackoff <= 0 {
+		cfg.BaseBackoff = DefaultBackoff
+	}
+	if cfg.MetricsPort < 0 || cfg.MetricsPort > 65535 {
+		errs = append(errs, fmt.Errorf("invalid metrics port %d", cfg.MetricsPort))
+	}
+	if cfg.ControlPort < 0 || cfg.ControlPort > 65535 {
+		errs = append(errs, fmt.Errorf("invalid control port %d", cfg.ControlPort))
+	}
+	if cfg.ControlHost == "" {
+		cfg.ControlHost = DefaultControlHost
+	}
+	if cfg.ShutdownTimeout <= 0 {
+		cfg.ShutdownTimeout = DefaultShutdown
+	}
+	if cfg.TrackingParams == nil {
+		cfg.TrackingParams = DefaultTrackingParams
+	}
+	if cfg.ContentTypes == nil {
+		cfg.ContentTypes = DefaultContentTypes
+	}
+	if cfg.MaxBodyBytes <= 0 {
+		cfg.MaxBodyBytes = DefaultMaxBodyBytes
+	}
+	if cfg.HTTPTimeout <= 0 {
+		cfg.HTTPTimeout = DefaultHTTPTimeout
+	}
+	if cfg.MaxIdleConns <= 0 {
+		cfg.MaxIdleConns = DefaultMaxIdleConns
+	}
+	if cfg.IdleConnTimeout <= 0 {
+		cfg.IdleConnTimeout = DefaultIdleConnTimeout
+	}
+	if cfg.RequestsPerSecond < 0 {
+		cfg.RequestsPerSecond = 0
+	}
+	if cfg.Burst <= 0 {
+		cfg.Burst = DefaultBurst
+	}
+	if cfg.MaxURLLength <= 0 {
+		cfg.MaxURLLength = DefaultMaxURLLength
+	}
+	if cfg.MaxPathSegments <= 0 {
+		cfg.MaxPathSegments = DefaultMaxSegments
+	}
+	if cfg.MaxSegmentRepeats <= 0 {
+		cfg.MaxSegmentRepeats = DefaultMaxRepeats
+	}
+	if cfg.LogLevel == "" {
+		cfg.LogLevel = DefaultLogLevel
+	}
+	logger, err := NewLogger(cfg.LogLevel, os.Stderr)
+	if err != nil {
+		errs = append(errs, err)
+		logger, _ = NewLogger(DefaultLogLevel, os.Stderr)
+	}
+	cfg.Logger = logger
+	if cfg.BearerToken != "" && cfg.BasicAuthUser != "" {
+		errs = append(errs, errors.New("basic auth and bearer token are mutually exclusive"))
+	}
+	if cfg.CookieFile != "" {
+		cfg.EnableCookies = true
+	}
+	if len(cfg.Headers) > 0 {
+		headers := make(map[string]string, len(cfg.Headers))
+		for name, value := range cfg.Headers {
+			name = textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(name))
+			if name == "" {
+				errs = append(errs, errors.New("invalid header: empty name"))
+				continue
+			}
+			headers[name] = value
+		}
+		cfg.Headers = headers
+		// robots.txt groups are matched against the agent actually sent.
+		if ua, ok := headers["User-Agent"]; ok {
+			cfg.UserAgent = ua
+		}
+	}
+	if cfg.UserAgent == "" {
+		cfg.UserAgent = DefaultUserAgent
+	}
+
+	if err := ValidateProxyURL(cfg.ProxyURL); err != nil {
+		errs = append(errs, err)
+	}
+	if err := ValidateConnString(cfg.DBConnectionString); err != nil {
+		errs = append(errs, err)
+	}
+	errs = append(errs, validatePatterns("include", cfg.IncludePatterns)...)
+	errs = append(errs, validatePatterns("exclude", cfg.ExcludePatterns)...)
+	for _, seed := range cfg.SeedUrls {
+		if !validSeed(seed) {
+			errs = append(errs, fmt.Errorf("invalid seed URL %q", seed))
+		}
+	}
+	if cfg.SeedFile != "" {
+		seeds, err := LoadSeedFile(cfg.SeedFile, cfg.Logger)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		cfg.SeedUrls = append(cfg.SeedUrls[:len(cfg.SeedUrls):len(cfg.SeedUrls)], seeds...)
+	}
+	errs = append(errs, validateJobs(cfg.Jobs)...)
+	switch {
+	case len(cfg.Jobs) > 0 && len(cfg.SeedUrls) > 0:
+		errs = append(errs, errors.New("seed URLs and jobs cannot be combined; give each job its own seeds"))
+	case len(cfg.Jobs) == 0 && len(cfg.SeedUrls) == 0:
+		errs = append(errs, errors.New("at least one seed URL is required"))
+	}
+	return cfg, errors.Join(errs...)
+}
+
+// NewLogger returns a text logger writing to w at the named level: debug,
+// info, warn or error.
+func NewLogger(level string, w io.Writer) (*slog.Logger, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q", level)
+	}
+	return slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: l})), nil
+}
+
+// validatePatterns returns an error for every pattern that is not a valid
+// regular expression. kind names the list in the errors.
+func validatePatterns(kind string, patterns []string) []error {
+	var errs []error
+	for _, p := range patterns {
+		if _, err := regexp.Compile(p); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s pattern: %w", kind, err))
+		}
+	}
+	return errs
+}
+
+// ValidateConnString checks that conn, if set, is a connection string the
+// postgres driver can parse. It does not connect. Errors never include the
+// password.
+func ValidateConnString(conn string) error {
+	if conn == "" {
+		return nil
+	}
+	if _, err := pq.NewConnector(conn); err != nil {
+		return fmt.Errorf("invalid database connection string %q: %s", common.RedactConnString(conn), common.RedactError(err, conn))
+	}
+	return nil
+}
+
+// ValidateProxyURL checks that proxy, if set, is an absolute http, https or
+// socks5 URL. Errors show the URL with any password redacted.
+func ValidateProxyURL(proxy string) error {
+	if proxy == "" {
+		return nil
+	}
+	u, err := url.Parse(proxy)
+	if err != nil {
+		// A *url.Error quotes the whole URL, password included.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("invalid proxy URL: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return fmt.Errorf("invalid proxy URL %q: scheme must be http, https or socks5", redactProxy(proxy))
+	}
+	if u.Host == "" {
+		return fmt.Errorf("invalid proxy URL %q: missing host", redactProxy(proxy))
+	}
+	return nil
+}
+
+// redactProxy hides the password in proxy for error messages. Without a
+// scheme, url.Parse does not see user info, so anything up to an @ is
+// dropped instead.
+func redactProxy(proxy string) string {
+	if !strings.Contains(proxy, "://") {
+		if i := strings.LastIndex(proxy, "@"); i >= 0 {
+			return "xxxxx" + proxy[i:]
+		}
+	}
+	return common.RedactConnString(proxy)
+}
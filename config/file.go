@@ -0,0 +1,73 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"gopkg.in/yaml.v3"
+
+	"crawler/common"
+)
+
+// DefaultConfig returns a configuration holding every default value.
+func DefaultConfig() *common.ConfigManager {
+	return &common.ConfigManager{
+		NumWorkers:        DefaultNumWorkers,
+		CrawlDelay:        DefaultCrawlDelay,
+		MinDelay:          DefaultMinDelay,
+		MaxDelay:          DefaultMaxDelay,
+		DelayFactor:       DefaultDelayFactor,
+		BreakerThreshold:  DefaultBreakerThreshold,
+		BreakerCooldown:   DefaultBreakerCooldown,
+		UserAgent:         DefaultUserAgent,
+		MaxPerHost:        DefaultMaxPerHost,
+		StorageType:       DefaultStorage,
+		VisitedSet:        DefaultVisitedSet,
+		BloomExpectedURLs: DefaultBloomExpected,
+		BloomFPRate:       DefaultBloomFPRate,
+		Frontier:          DefaultFrontier,
+		FrontierPath:      DefaultFrontierPath,
+		Fetcher:           DefaultFetcher,
+		ControlHost:       DefaultControlHost,
+		BatchSize:         DefaultBatchSize,
+		FlushInterval:     DefaultFlushInterval,
+		MaxRetries:        DefaultMaxRetries,
+		MaxRedirects:      DefaultMaxRedirects,
+		MaxBodyBytes:      DefaultMaxBodyBytes,
+		BaseBackoff:       DefaultBackoff,
+		ShutdownTimeout:   DefaultShutdown,
+		HTTPTimeout:       DefaultHTTPTimeout,
+		MaxIdleConns:      DefaultMaxIdleConns,
+		IdleConnTimeout:   DefaultIdleConnTimeout,
+		Burst:             DefaultBurst,
+		LogLevel:          DefaultLogLevel,
+		MaxURLLength:      DefaultMaxURLLength,
+		MaxPathSegments:   DefaultMaxSegments,
+		MaxSegmentRepeats: DefaultMaxRepeats,
+		TrackingParams:    append([]string(nil), DefaultTrackingParams...),
+		ContentTypes:      append([]string(nil), DefaultContentTypes...),
+	}
+}
+
+// LoadConfig reads a YAML or JSON config file on top of DefaultConfig.
+// Durations are written as strings such as "500ms". Unknown keys are
+// rejected so typos don't go unnoticed. The result is not validated; pass it
+// through the CLI flags and NewConfigManager for that.
+func LoadConfig(path string) (*common.ConfigManager, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config: %w", err)
+	}
+
+	cfg := DefaultConfig()
+	// JSON is a subset of YAML, so one decoder handles both formats.
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("parsing config %s: %w", path, err)
+	}
+	return cfg, nil
+}
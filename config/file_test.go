@@ -0,0 +1,77 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"crawler/common"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigRoundTrip(t *testing.T) {
+	want := DefaultConfig()
+	want.SeedUrls = []string{"https://example.com/"}
+	want.NumWorkers = 8
+	want.CrawlDelay = 250 * time.Millisecond
+	want.MaxDepth = 3
+	want.AllowedDomains = []string{"example.com"}
+	want.ExcludePatterns = []string{`\.pdf$`}
+	want.Headers = map[string]string{"Accept-Language": "en"}
+	want.Jobs = []common.JobConfig{{ID: "docs", SeedUrls: []string{"https://docs.example.com/"}, MaxDepth: 2}}
+	out, err := yaml.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := LoadConfig(writeFile(t, "crawler.yaml", string(out)))
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	// Unset lists come back empty rather than nil, so compare the YAML.
+	again, err := yaml.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(again) != string(out) {
+		t.Errorf("loaded config differs from the one written:\ngot:\n%s\nwant:\n%s", again, out)
+	}
+}
+
+func TestLoadConfigKeepsDefaults(t *testing.T) {
+	cfg, err := LoadConfig(writeFile(t, "crawler.json", `{"seed_urls": ["https://example.com/"], "crawl_delay": "2s"}`))
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if cfg.CrawlDelay != 2*time.Second {
+		t.Errorf("CrawlDelay = %v, want 2s", cfg.CrawlDelay)
+	}
+	if cfg.NumWorkers != DefaultNumWorkers || cfg.UserAgent != DefaultUserAgent {
+		t.Errorf("unset fields lost their defaults: workers %d, user agent %q", cfg.NumWorkers, cfg.UserAgent)
+	}
+}
+
+func TestLoadConfigRejectsUnknownKeys(t *testing.T) {
+	_, err := LoadConfig(writeFile(t, "crawler.yaml", "num_wrokers: 3\n"))
+	if err == nil || !strings.Contains(err.Error(), "num_wrokers") {
+		t.Errorf("LoadConfig error = %v, want one naming num_wrokers", err)
+	}
+}
+
+func TestLoadExampleConfig(t *testing.T) {
+	if _, err := LoadConfig("example.yaml"); err != nil {
+		t.Errorf("LoadConfig(example.yaml): %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+
+	"crawler/common"
+)
+
+// jobIDPattern keeps job IDs usable in file names.
+var jobIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// validateJobs returns an error for every job without a unique,
+// file-name-safe ID, without seeds or with an invalid seed URL or pattern.
+func validateJobs(jobs []common.JobConfig) []error {
+	var errs []error
+	seen := make(map[string]bool, len(jobs))
+	for i, job := range jobs {
+		if !jobIDPattern.MatchString(job.ID) {
+			errs = append(errs, fmt.Errorf("job %d: invalid id %q: use letters, digits, '-' and '_'", i+1, job.ID))
+		} else if seen[job.ID] {
+			errs = append(errs, fmt.Errorf("job %s: duplicate id", job.ID))
+		}
+		seen[job.ID] = true
+		if len(job.SeedUrls) == 0 {
+			errs = append(errs, fmt.Errorf("job %s: at least one seed URL is required", job.ID))
+		}
+		for _, seed := range job.SeedUrls {
+			if !validSeed(seed) {
+				errs = append(errs, fmt.Errorf("job %s: invalid seed URL %q", job.ID, seed))
+			}
+		}
+		for _, err := range validatePatterns("include", job.IncludePatterns) {
+			errs = append(errs, fmt.Errorf("job %s: %w", job.ID, err))
+		}
+		for _, err := range validatePatterns("exclude", job.ExcludePatterns) {
+			errs = append(errs, fmt.Errorf("job %s: %w", job.ID, err))
+		}
+	}
+	return errs
+}
+
+// ForJob returns the configuration of one job of cfg: a copy of cfg with the
+// job's seeds, domain rules and filters. Output, state and frontier files
+// inherited from cfg get the job ID added to their names so jobs never share
+// a file.
+func ForJob(cfg *common.ConfigManager, job common.JobConfig) *common.ConfigManager {
+	jc := *cfg
+	jc.Jobs = nil
+	jc.SeedUrls = job.SeedUrls
+	jc.AllowedDomains = job.AllowedDomains
+	jc.AllowSubdomains = job.AllowSubdomains
+	jc.IncludePatterns = job.IncludePatterns
+	jc.ExcludePatterns = job.ExcludePatterns
+	if job.MaxDepth > 0 {
+		jc.MaxDepth = job.MaxDepth
+	}
+	if job.OutputFormat != "" {
+		jc.OutputFormat, jc.OutputPath = job.OutputFormat, job.OutputPath
+	} else {
+		jc.OutputPath = jobPath(cfg.OutputPath, job.ID)
+	}
+	if jc.StateFile = job.StateFile; jc.StateFile == "" {
+		jc.StateFile = jobPath(cfg.StateFile, job.ID)
+	}
+	jc.FrontierPath = jobPath(cfg.FrontierPath, job.ID)
+	return &jc
+}
+
+// jobPath inserts id before the extension of path. Empty paths and "-",
+// meaning stdout, are returned unchanged.
+func jobPath(path, id string) string {
+	if path == "" || path == "-" {
+		return path
+	}
+	ext := filepath.Ext(path)
+	return path[:len(path)-len(ext)] + "-" + id + ext
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// LoadSeedFile reads seed URLs from path, or from stdin when path is "-".
+// See ReadSeeds for the format.
+func LoadSeedFile(path string, logger *slog.Logger) ([]string, error) {
+	if path == "-" {
+		return ReadSeeds(os.Stdin, "stdin", logger)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading seed file: %w", err)
+	}
+	defer f.Close()
+	return ReadSeeds(f, path, logger)
+}
+
+// ReadSeeds reads one URL per line from r, skipping blank lines and lines
+// starting with #. Malformed URLs are logged with their line number and
+// skipped; name identifies r in those messages.
+func ReadSeeds(r io.Reader, name string, logger *slog.Logger) ([]string, error) {
+	var seeds []string
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		if !validSeed(text) {
+			logger.Warn("skipping malformed seed URL", "file", name, "line", line, "url", text)
+			continue
+		}
+		seeds = append(seeds, text)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading seeds from %s: %w", name, err)
+	}
+	return seeds, nil
+}
+
+// validSeed reports whether seed is an absolute http or https URL.
+func validSeed(seed string) bool {
+	u, err := url.Parse(seed)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"bytes"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLoadSeedFile(t *testing.T) {
+	path := writeFile(t, "seeds.txt", `# seeds for the docs crawl
+https://example.com/
+
+  http://example.org/start  
+not a url
+# https://commented.example/
+https://example.net/a?b=c
+`)
+	var logs bytes.Buffer
+	seeds, err := LoadSeedFile(path, slog.New(slog.NewTextHandler(&logs, nil)))
+	if err != nil {
+		t.Fatalf("LoadSeedFile: %v", err)
+	}
+	want := []string{"https://example.com/", "http://example.org/start", "https://example.net/a?b=c"}
+	if !slices.Equal(seeds, want) {
+		t.Errorf("seeds = %q, want %q", seeds, want)
+	}
+	if !strings.Contains(logs.String(), "line=5") || !strings.Contains(logs.String(), `url="not a url"`) {
+		t.Errorf("malformed line not logged with its number:\n%s", logs.String())
+	}
+}
+
+func TestLoadSeedFileMissing(t *testing.T) {
+	if _, err := LoadSeedFile("/nonexistent/seeds.txt", slog.New(slog.DiscardHandler)); err == nil {
+		t.Error("LoadSeedFile of a missing file succeeded")
+	}
+}
+
+func TestSeedFileCombinedWithFlags(t *testing.T) {
+	flags := validFlags()
+	flags.SeedFile = writeFile(t, "seeds.txt", "https://example.org/\nbad\n")
+	cfg, err := NewConfigManager(flags)
+	if err != nil {
+		t.Fatalf("NewConfigManager: %v", err)
+	}
+	if want := []string{"http://example.com/", "https://example.org/"}; !slices.Equal(cfg.SeedUrls, want) {
+		t.Errorf("SeedUrls = %q, want %q", cfg.SeedUrls, want)
+	}
+}
@@ -0,0 +1,116 @@
+// Package control serves an HTTP API for inspecting and steering a running
+// crawl.
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+
+	"crawler"
+)
+
+// Server exposes the control API:
+//
+//	GET  /status    frontier size, visited count, in-flight URLs and stats
+//	POST /pause     stop starting new pages
+//	POST /resume    continue a paused crawl
+//	POST /shutdown  stop gracefully, as on SIGINT
+type Server struct {
+	srv *http.Server
+}
+
+type statusResponse struct {
+	Queued          int            `json:"queued"`
+	Visited         int            `json:"visited"`
+	InFlight        int            `json:"in_flight"`
+	Paused          bool           `json:"paused"`
+	PagesFetched    int            `json:"pages_fetched"`
+	PagesStored     int            `json:"pages_stored"`
+	Errors          int            `json:"errors"`
+	BytesDownloaded int64          `json:"bytes_downloaded"`
+	UniqueHosts     int            `json:"unique_hosts"`
+	Disallowed      int            `json:"disallowed"`
+	Rejected        int            `json:"rejected"`
+	Trapped         int            `json:"trapped"`
+	Duration        string         `json:"duration"`
+	PagesPerSecond  float64        `json:"pages_per_second"`
+	HostErrors      map[string]int `json:"host_errors,omitempty"`
+}
+
+// Handler returns the control API for c.
+func Handler(c *crawler.Crawler) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, newStatusResponse(c.Status()))
+	})
+	mux.HandleFunc("POST /pause", func(w http.ResponseWriter, r *http.Request) {
+		c.Pause()
+		writeJSON(w, newStatusResponse(c.Status()))
+	})
+	mux.HandleFunc("POST /resume", func(w http.ResponseWriter, r *http.Request) {
+		c.Resume()
+		writeJSON(w, newStatusResponse(c.Status()))
+	})
+	mux.HandleFunc("POST /shutdown", func(w http.ResponseWriter, r *http.Request) {
+		c.Shutdown()
+		w.WriteHeader(http.StatusAccepted)
+	})
+	return mux
+}
+
+// StartServer serves the control API for c on host and port in the
+// background, logging serve errors to logger. The API is unauthenticated,
+// so host should normally be a loopback address. A port of zero disables
+// the server and returns nil; a nil *Server is safe to Shutdown.
+func StartServer(host string, port int, c *crawler.Crawler, logger *slog.Logger) *Server {
+	if port == 0 {
+		return nil
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	s := &Server{srv: &http.Server{Addr: addr, Handler: Handler(c)}}
+	go func() {
+		if err := s.srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("control server failed", "error", err)
+		}
+	}()
+	return s
+}
+
+// Shutdown stops the server, waiting for in-progress requests until ctx is
+// done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	if s == nil {
+		return nil
+	}
+	return s.srv.Shutdown(ctx)
+}
+
+func newStatusResponse(st crawler.Status) statusResponse {
+	return statusResponse{
+		Queued:          st.Queued,
+		Visited:         st.Visited,
+		InFlight:        st.InFlight,
+		Paused:          st.Paused,
+		PagesFetched:    st.Stats.PagesFetched,
+		PagesStored:     st.Stats.PagesStored,
+		Errors:          st.Stats.Errors,
+		BytesDownloaded: st.Stats.BytesDownloaded,
+		UniqueHosts:     st.Stats.UniqueHosts,
+		Disallowed:      st.Stats.Disallowed,
+		Rejected:        st.Stats.Rejected,
+		Trapped:         st.Stats.Trapped,
+		Duration:        st.Stats.Duration.String(),
+		PagesPerSecond:  st.Stats.PagesPerSecond,
+		HostErrors:      st.Stats.HostErrors,
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,154 @@
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"crawler"
+	"crawler/config"
+	"crawler/storage"
+)
+
+// gatedSite serves a seed linking to /a, /b and /c. Each of those is
+// reported on arrived and then held until a token is sent on proceed.
+func gatedSite(t *testing.T) (srv *httptest.Server, arrived chan string, proceed chan struct{}) {
+	arrived, proceed = make(chan string, 3), make(chan struct{})
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<a href="/a">a</a> <a href="/b">b</a> <a href="/c">c</a>`))
+		case "/a", "/b", "/c":
+			arrived <- r.URL.Path
+			select {
+			case <-proceed:
+			case <-r.Context().Done():
+			}
+			w.Write([]byte("<title>" + r.URL.Path + "</title>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, arrived, proceed
+}
+
+func call(t *testing.T, api *httptest.Server, method, path string) (int, statusResponse) {
+	t.Helper()
+	req, err := http.NewRequest(method, api.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var status statusResponse
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+			t.Fatalf("%s %s: decoding response: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode, status
+}
+
+// waitFor polls the status endpoint until ok accepts the status.
+func waitFor(t *testing.T, api *httptest.Server, what string, ok func(statusResponse) bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, status := call(t, api, http.MethodGet, "/status"); ok(status) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestControlAPI(t *testing.T) {
+	site, arrived, proceed := gatedSite(t)
+	cfg := config.DefaultConfig()
+	cfg.SeedUrls = []string{site.URL + "/"}
+	cfg.CrawlDelay = 0
+	cfg.NumWorkers = 1
+	cfg.Logger = slog.New(slog.DiscardHandler)
+	c, err := crawler.NewCrawler(cfg, storage.NewMemoryStorage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := httptest.NewServer(Handler(c))
+	defer api.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	finished := make(chan error, 1)
+	go func() { finished <- c.Start(ctx) }()
+	<-arrived
+
+	// A URL counts as in flight from the moment it is dequeued, so the
+	// next one may already be waiting for the worker.
+	code, status := call(t, api, http.MethodGet, "/status")
+	if code != http.StatusOK || status.InFlight < 1 || status.InFlight+status.Queued != 3 || status.Paused || status.PagesFetched != 1 {
+		t.Errorf("GET /status = %d %+v, want one page done and three in flight or queued", code, status)
+	}
+
+	if code, status := call(t, api, http.MethodPost, "/pause"); code != http.StatusOK || !status.Paused {
+		t.Errorf("POST /pause = %d %+v, want paused", code, status)
+	}
+	// The page in flight finishes, but no other one starts.
+	proceed <- struct{}{}
+	waitFor(t, api, "the in-flight page", func(s statusResponse) bool { return s.InFlight == 0 })
+	select {
+	case path := <-arrived:
+		t.Errorf("%s fetched while paused", path)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if code, status := call(t, api, http.MethodPost, "/resume"); code != http.StatusOK || status.Paused {
+		t.Errorf("POST /resume = %d %+v, want running", code, status)
+	}
+	select {
+	case <-arrived:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no page fetched after resuming")
+	}
+
+	if code, _ := call(t, api, http.MethodPost, "/shutdown"); code != http.StatusAccepted {
+		t.Errorf("POST /shutdown = %d, want %d", code, http.StatusAccepted)
+	}
+	proceed <- struct{}{}
+	select {
+	case err := <-finished:
+		if err != nil {
+			t.Errorf("Start returned %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("crawl still running after POST /shutdown")
+	}
+	if _, status := call(t, api, http.MethodGet, "/status"); status.Queued != 1 || status.PagesStored != 3 {
+		t.Errorf("after shutdown: %+v, want three pages stored and one left queued", status)
+	}
+}
+
+func TestControlAPIMethods(t *testing.T) {
+	c, err := crawler.NewCrawler(config.DefaultConfig(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := httptest.NewServer(Handler(c))
+	defer api.Close()
+	for _, path := range []string{"/pause", "/resume", "/shutdown"} {
+		if code, _ := call(t, api, http.MethodGet, path); code != http.StatusMethodNotAllowed {
+			t.Errorf("GET %s = %d, want %d", path, code, http.StatusMethodNotAllowed)
+		}
+	}
+}
@@ -0,0 +1,572 @@
+// Package crawler is an embeddable web crawler. A Crawler walks outward from
+// the configured seed URLs, stores every page it fetches and streams the
+// results to callers.
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"crawler/common"
+	"crawler/fetcher"
+	"crawler/metrics"
+	"crawler/parser"
+	"crawler/urlmanager"
+)
+
+// Crawler runs the crawl described by a ConfigManager, made of one or more
+// jobs.
+type Crawler struct {
+	cfg      *common.ConfigManager
+	client   *http.Client
+	fetcher  fetcher.Fetcher
+	sitemaps *fetcher.HTTPFetcher // accepts any content type
+	browser  *fetcher.HeadlessFetcher
+	robots   *common.RobotsManager
+	limiter  *rate.Limiter
+	slots    chan struct{} // bounds pages processed at once across jobs
+	jobs     []*job
+	hooks    hooks
+	log      *slog.Logger
+	stats    statsCollector
+
+	mu       sync.Mutex
+	started  bool
+	finished bool
+	results  chan common.PageStorageData
+}
+
+// Job is one of several independent crawls run by a Crawler. Config holds
+// its seeds, domain rules, filters and state file, and is normally built
+// with config.ForJob. Pages are written to Storage, which may be nil.
+type Job struct {
+	ID      string
+	Config  *common.ConfigManager
+	Storage common.Storage
+}
+
+// job is the running form of a Job.
+type job struct {
+	id        string
+	cfg       *common.ConfigManager
+	storage   common.Storage
+	urls      *urlmanager.UrlManager
+	stateFile string // cfg.StateFile, or empty in a dry run
+	log       *slog.Logger
+}
+
+// NewCrawler prepares a crawl of cfg, which is normally built with
+// config.NewConfigManager or config.DefaultConfig so unset fields get their
+// defaults. Pages are written to storage, which may be nil when the caller
+// only consumes Results. The caller keeps ownership of storage and closes it
+// after Start returns.
+func NewCrawler(cfg *common.ConfigManager, storage common.Storage) (*Crawler, error) {
+	return NewJobCrawler(cfg, []Job{{Config: cfg, Storage: storage}})
+}
+
+// NewJobCrawler prepares a crawl running jobs side by side. They share the
+// HTTP client, robots.txt cache and rate limit of cfg, and no more than
+// cfg.NumWorkers pages are processed at once across all of them. The caller
+// keeps ownership of every job's storage and closes it after Start returns.
+// A job whose include or exclude patterns do not compile is an error.
+func NewJobCrawler(cfg *common.ConfigManager, jobs []Job) (*Crawler, error) {
+	// Credentials default to the hosts of every job's seeds.
+	shared := *cfg
+	shared.SeedUrls = nil
+	for _, j := range jobs {
+		shared.SeedUrls = append(shared.SeedUrls, j.Config.SeedUrls...)
+	}
+	client := fetcher.NewClient(cfg)
+	robots := common.NewRobotsManager(client, cfg.UserAgent)
+	sitemapCfg := shared
+	sitemapCfg.ContentTypes = nil
+	c := &Crawler{
+		cfg:      cfg,
+		client:   client,
+		fetcher:  fetcher.NewHTTPFetcher(&shared, client),
+		sitemaps: fetcher.NewHTTPFetcher(&sitemapCfg, client),
+		robots:   robots,
+		slots:    make(chan struct{}, cfg.NumWorkers),
+		log:      cfg.Log(),
+	}
+	for _, j := range jobs {
+		urls, err := urlmanager.NewUrlManager(j.Config, robots)
+		if err != nil {
+			for _, run := range c.jobs {
+				run.urls.Close()
+			}
+			if j.ID != "" {
+				return nil, fmt.Errorf("job %s: %w", j.ID, err)
+			}
+			return nil, err
+		}
+		run := &job{
+			id:      j.ID,
+			cfg:     j.Config,
+			storage: j.Storage,
+			urls:    urls,
+			log:     c.log,
+		}
+		if j.ID != "" {
+			run.log = c.log.With("job", j.ID)
+		}
+		run.urls.OnEnqueue(func(e urlmanager.Entry) {
+			c.hooks.runDiscover(run.id, e.URL, e.Depth)
+		})
+		if !cfg.DryRun {
+			run.stateFile = j.Config.StateFile
+		}
+		c.jobs = append(c.jobs, run)
+	}
+	// A global rate limit replaces the fixed per-worker crawl delay.
+	if cfg.RequestsPerSecond > 0 {
+		c.limiter = rate.NewLimiter(rate.Limit(cfg.RequestsPerSecond), int(cfg.Burst))
+	}
+	if cfg.Fetcher == fetcher.FetcherHeadless {
+		if browser, err := fetcher.NewHeadlessFetcher(&shared); err != nil {
+			c.log.Error("headless fetcher unavailable, fetching pages over http", "error", err)
+		} else {
+			c.fetcher, c.browser = browser, browser
+		}
+	}
+	return c, nil
+}
+
+// Results returns a channel receiving every page stored from the first call
+// on. It is closed when Start returns. Once Results has been called the
+// channel must be drained, or workers block until ctx is cancelled.
+func (c *Crawler) Results() <-chan common.PageStorageData {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.results == nil {
+		c.results = make(chan common.PageStorageData, c.cfg.NumWorkers)
+		if c.finished {
+			close(c.results)
+		}
+	}
+	return c.results
+}
+
+func (c *Crawler) resultsChan() chan<- common.PageStorageData {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.results
+}
+
+// Start crawls until the frontier of every job is exhausted, Shutdown is
+// called or ctx is cancelled, and returns ctx's error in the latter case.
+// When a job has a state file it resumes from it and saves its progress
+// there. In a dry run pages are sent to Results without being stored and
+// state files are ignored.
+func (c *Crawler) Start(ctx context.Context) error {
+	c.mu.Lock()
+	if c.started {
+		c.mu.Unlock()
+		return errors.New("crawler already started")
+	}
+	c.started = true
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.finished = true
+		if c.results != nil {
+			close(c.results)
+		}
+		c.mu.Unlock()
+	}()
+
+	c.stats.begin()
+	defer c.stats.finish()
+	for _, j := range c.jobs {
+		c.seed(ctx, j)
+		j.urls.RunWorkers(ctx, int(c.cfg.NumWorkers), func(ctx context.Context, pageURL string, depth int) {
+			c.crawl(ctx, j, pageURL, depth)
+		})
+		if j.stateFile != "" && c.cfg.CheckpointInterval > 0 {
+			go j.urls.Checkpoint(j.stateFile, c.cfg.CheckpointInterval)
+		}
+	}
+	for _, j := range c.jobs {
+		j.urls.Wait()
+	}
+
+	for _, j := range c.jobs {
+		if j.stateFile != "" {
+			// A drained queue means there is nothing left to resume.
+			if j.urls.QueueLen() == 0 {
+				os.Remove(j.stateFile)
+			} else if err := j.urls.SaveState(j.stateFile); err != nil {
+				j.log.Error("saving crawl state failed", "error", err)
+			}
+		}
+		if err := j.urls.Close(); err != nil {
+			j.log.Error("closing frontier failed", "error", err)
+		}
+	}
+	if c.browser != nil {
+		c.browser.Close()
+	}
+	return ctx.Err()
+}
+
+// UseFetcher makes the crawl fetch pages with f instead of the fetcher
+// selected by the configuration. Robots.txt and sitemaps are still fetched
+// over HTTP. It must be called before Start, and f is not closed by the
+// crawler.
+func (c *Crawler) UseFetcher(f fetcher.Fetcher) {
+	c.fetcher = f
+}
+
+// Shutdown stops handing out new URLs; Start returns once in-flight pages
+// are done.
+func (c *Crawler) Shutdown() {
+	for _, j := range c.jobs {
+		j.urls.Shutdown()
+	}
+}
+
+// Pause stops workers from starting new pages until Resume; pages already
+// being fetched are finished.
+func (c *Crawler) Pause() {
+	for _, j := range c.jobs {
+		j.urls.Pause()
+	}
+}
+
+// Resume continues a paused crawl.
+func (c *Crawler) Resume() {
+	for _, j := range c.jobs {
+		j.urls.Resume()
+	}
+}
+
+// Status describes the frontier of a running crawl.
+type Status struct {
+	Queued   int
+	Visited  int
+	InFlight int
+	Paused   bool
+	Stats    Stats
+}
+
+// Status returns a snapshot of the crawl's progress, summed over jobs.
+func (c *Crawler) Status() Status {
+	var status Status
+	for _, j := range c.jobs {
+		status.Queued += j.urls.QueueLen()
+		status.Visited += j.urls.VisitedLen()
+		status.InFlight += j.urls.ActiveLen()
+		status.Paused = j.urls.Paused()
+	}
+	status.Stats = c.Stats()
+	return status
+}
+
+// SaveState writes the crawl state of every job to its state file, if any.
+// It does nothing in a dry run.
+func (c *Crawler) SaveState() error {
+	var errs []error
+	for _, j := range c.jobs {
+		if j.stateFile != "" {
+			errs = append(errs, j.urls.SaveState(j.stateFile))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Disallowed returns how many URLs robots.txt kept us from crawling.
+func (c *Crawler) Disallowed() int {
+	n := 0
+	for _, j := range c.jobs {
+		n += j.urls.Disallowed()
+	}
+	return n
+}
+
+// Rejected returns how many URLs fell outside the allowed domains or were
+// filtered out by the include/exclude patterns.
+func (c *Crawler) Rejected() int {
+	n := 0
+	for _, j := range c.jobs {
+		n += j.urls.Rejected()
+	}
+	return n
+}
+
+// Trapped returns how many URLs were dropped as likely crawler traps.
+func (c *Crawler) Trapped() int {
+	n := 0
+	for _, j := range c.jobs {
+		n += j.urls.Trapped()
+	}
+	return n
+}
+
+// HostErrors returns how many fetches failed per host because the host
+// was in trouble, as counted by the circuit breaker.
+func (c *Crawler) HostErrors() map[string]int {
+	errs := make(map[string]int)
+	for _, j := range c.jobs {
+		for host, n := range j.urls.HostErrors() {
+			errs[host] += n
+		}
+	}
+	return errs
+}
+
+// seed enqueues the seed URLs of j, and those listed in their hosts'
+// sitemaps when enabled, or restores its frontier from the state file.
+func (c *Crawler) seed(ctx context.Context, j *job) {
+	if j.stateFile != "" {
+		switch err := j.urls.LoadState(j.stateFile); {
+		case err == nil:
+			j.log.Info("resuming crawl", "state_file", j.stateFile, "queued", j.urls.QueueLen())
+			return
+		case !errors.Is(err, os.ErrNotExist):
+			j.log.Warn("ignoring unreadable crawl state, starting fresh", "error", err)
+		}
+	}
+	// Without a state file to go with them, URLs left in a disk frontier
+	// have no visited set and would be crawled twice.
+	if n := j.urls.QueueLen(); n > 0 {
+		j.log.Info("discarding URLs left in the frontier by an earlier crawl", "queued", n)
+		if err := j.urls.ClearQueue(); err != nil {
+			j.log.Error("clearing frontier failed", "error", err)
+		}
+	}
+	for _, seed := range j.cfg.SeedUrls {
+		j.urls.Add(ctx, seed, 0)
+	}
+	if c.cfg.UseSitemap {
+		c.seedSitemaps(ctx, j)
+	}
+}
+
+// crawl fetches, parses and stores one page of j, then enqueues its links.
+func (c *Crawler) crawl(ctx context.Context, j *job, pageURL string, depth int) {
+	if err := c.hooks.runBeforeFetch(pageURL); err != nil {
+		j.log.Debug("skipped by hook", "url", pageURL, "error", err)
+		return
+	}
+	delay := c.cfg.CrawlDelay
+	if c.limiter != nil {
+		delay = 0
+	}
+	host := ""
+	if u, err := url.Parse(pageURL); err == nil {
+		host = u.Host
+		if d, ok := j.urls.HostDelay(host); ok {
+			delay = d
+		}
+		if d := c.robots.CrawlDelay(host); d > delay {
+			delay = d
+		}
+	}
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+		return
+	}
+	select {
+	case c.slots <- struct{}{}:
+		defer func() { <-c.slots }()
+	case <-ctx.Done():
+		return
+	}
+	if c.limiter != nil {
+		if err := c.limiter.Wait(ctx); err != nil {
+			return
+		}
+	}
+
+	hops := &redirectHops{urls: j.urls, accepted: make(map[string]bool)}
+	page := c.fetchPage(fetcher.WithRedirectCheck(ctx, hops.check), j, pageURL)
+	c.hooks.runAfterFetch(&page)
+	if page.Latency > 0 {
+		j.urls.RecordLatency(host, page.Latency)
+	}
+	if ctx.Err() == nil {
+		j.urls.RecordFetch(host, fetcher.HostFailure(page.Err))
+	}
+	if page.StatusCode == http.StatusNotModified {
+		metrics.PagesNotModified.Inc()
+		j.log.Debug("not modified since last crawl", "url", pageURL)
+		return
+	}
+	var typeErr *fetcher.ContentTypeError
+	if errors.As(page.Err, &typeErr) {
+		j.log.Debug("skipping unwanted content type", "url", pageURL, "content_type", typeErr.ContentType)
+		return
+	}
+	var redirectErr *fetcher.RedirectError
+	if errors.As(page.Err, &redirectErr) {
+		j.log.Debug("not following redirect", "url", pageURL, "redirected_to", redirectErr.To, "reason", redirectErr.Reason)
+		return
+	}
+	if page.Err != nil && ctx.Err() != nil {
+		// Cancelled along with the crawl; the URL is kept for resuming.
+		return
+	}
+	if page.Err != nil {
+		metrics.FetchErrors.Inc()
+		c.stats.failed()
+		j.log.Warn("fetch failed", "url", pageURL, "error", page.Err)
+		return
+	}
+	metrics.PagesFetched.Inc()
+	c.stats.fetchedPage(pageURL, len(page.Body))
+	if page.FinalURL != "" && page.FinalURL != page.URL {
+		// Fetchers that follow redirects themselves, like a browser, skip
+		// the per-hop check, so the final URL is vetted here instead.
+		if !hops.accepted[page.FinalURL] {
+			if reason := j.urls.MarkRedirect(ctx, pageURL, page.FinalURL); reason != "" {
+				j.log.Debug("not storing redirected page", "url", pageURL, "redirected_to", page.FinalURL, "reason", reason)
+				return
+			}
+		}
+		page.URL = page.FinalURL
+	}
+	data, links, err := parser.ParsePage(page.Body, page.URL)
+	if err != nil {
+		j.log.Warn("parse failed", "url", page.URL, "error", err)
+		return
+	}
+	j.log.Info("crawled", "url", page.URL, "title", data.Title, "links", data.LinkCount)
+
+	for _, link := range links {
+		j.urls.Add(ctx, link, depth+1)
+	}
+	data.ContentHash = parser.ContentHash(page.Body)
+	if data.Language == "" {
+		data.Language = parser.NormalizeLanguage(page.Language)
+	}
+	data.ETag, data.LastModified = page.ETag, page.LastModified
+	if c.cfg.RecordAllLinks {
+		data.Links = links
+	}
+	data.JobID = j.id
+	if err := c.hooks.runBeforeStore(&data); err != nil {
+		j.log.Debug("dropped by hook", "url", data.URL, "error", err)
+		return
+	}
+	if !j.urls.ReservePage() {
+		j.log.Debug("page limit reached, not storing", "url", data.URL)
+		return
+	}
+	stored := c.cfg.DryRun || c.store(ctx, j, &data)
+	if stored {
+		j.urls.PageStored()
+	} else {
+		j.urls.ReleasePage()
+	}
+	if results := c.resultsChan(); stored && results != nil {
+		select {
+		case results <- data:
+		case <-ctx.Done():
+		}
+	}
+}
+
+// saveAlias records alias as a duplicate of original if storage supports it.
+func (c *Crawler) saveAlias(ctx context.Context, j *job, alias, original string) {
+	aliases, ok := j.storage.(common.AliasStorage)
+	if !ok {
+		return
+	}
+	if err := aliases.SaveAlias(ctx, alias, original); err != nil {
+		j.log.Error("storing alias failed", "url", alias, "error", err)
+	}
+}
+
+// redirectHops vets the redirect hops of one fetch with the job's URL
+// manager, so a chain stops at the first hop leaving the allowed domains,
+// disallowed by robots.txt or leading to a URL already seen. A retried
+// fetch repeats its hops, so those already accepted pass again.
+type redirectHops struct {
+	urls     *urlmanager.UrlManager
+	accepted map[string]bool
+}
+
+func (h *redirectHops) check(ctx context.Context, from, to string) string {
+	if h.accepted[to] {
+		return ""
+	}
+	if reason := h.urls.MarkRedirect(ctx, from, to); reason != "" {
+		return reason
+	}
+	h.accepted[to] = true
+	return ""
+}
+
+// fetchPage fetches pageURL, conditionally when storage holds cache
+// validators from an earlier crawl and the fetcher supports it. A failure
+// is recorded in the page's Err, where hooks see it.
+func (c *Crawler) fetchPage(ctx context.Context, j *job, pageURL string) common.FetchedPageData {
+	validators, ok := j.storage.(common.ValidatorStorage)
+	conditional, canSkip := c.fetcher.(fetcher.ConditionalFetcher)
+	if !ok || !canSkip {
+		page, err := c.fetcher.Fetch(ctx, pageURL)
+		page.Err = err
+		return page
+	}
+	etag, lastModified, err := validators.Validators(ctx, pageURL)
+	if err != nil {
+		j.log.Warn("loading cache validators failed", "url", pageURL, "error", err)
+	}
+	page, err := conditional.FetchIfModified(ctx, pageURL, etag, lastModified)
+	page.Err = err
+	return page
+}
+
+// store saves data unless a page with the same canonical URL or identical
+// content was already stored, in which case data's URL is recorded as an
+// alias of that page. A page declaring a canonical URL is stored under it,
+// with the URL it was fetched from as an alias, so the record keeps the
+// canonical identity whichever variant is fetched first. It reports whether
+// a new record was written.
+func (c *Crawler) store(ctx context.Context, j *job, data *common.PageStorageData) bool {
+	pageURL := data.URL
+	identity, ok := j.urls.ClaimCanonical(data.CanonicalURL, pageURL)
+	if !ok {
+		j.log.Debug("canonical URL already stored, not storing", "url", pageURL, "canonical", data.CanonicalURL, "same_as", identity)
+		if identity != pageURL {
+			c.saveAlias(ctx, j, pageURL, identity)
+		}
+		return false
+	}
+	if data.CanonicalURL != "" {
+		data.URL = identity
+	}
+	if owner, ok := j.urls.ClaimContent(data.ContentHash, data.URL); !ok {
+		j.urls.ReleaseCanonical(data.CanonicalURL, pageURL)
+		data.URL = pageURL
+		j.log.Debug("duplicate content, not storing", "url", pageURL, "same_as", owner)
+		c.saveAlias(ctx, j, pageURL, owner)
+		return false
+	}
+	if j.storage == nil {
+		return true
+	}
+	if err := j.storage.Save(ctx, *data); err != nil {
+		j.urls.ReleaseCanonical(data.CanonicalURL, pageURL)
+		j.urls.ReleaseContent(data.ContentHash)
+		data.URL = pageURL
+		j.log.Error("storing page failed", "url", pageURL, "error", err)
+		return false
+	}
+	if data.URL != pageURL {
+		c.saveAlias(ctx, j, pageURL, data.URL)
+	}
+	metrics.PagesStored.Inc()
+	c.stats.storedPage()
+	return true
+}
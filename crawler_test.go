@@ -0,0 +1,832 @@
+package crawler
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"crawler/common"
+	"crawler/config"
+	"crawler/metrics"
+	"crawler/storage"
+)
+
+// site serves HTML pages keyed by path and counts the requests for each.
+// Unknown paths, robots.txt included, are 404s.
+type site struct {
+	*httptest.Server
+	mu        sync.Mutex
+	hits      map[string]int
+	redirects map[string]string
+	types     map[string]string
+}
+
+func newSite(t *testing.T, pages map[string]string) *site {
+	t.Helper()
+	s := &site{hits: make(map[string]int), redirects: make(map[string]string), types: make(map[string]string)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.hits[r.URL.Path]++
+		target, redirect := s.redirects[r.URL.Path]
+		contentType, ok := s.types[r.URL.Path]
+		s.mu.Unlock()
+		if !ok {
+			contentType = "text/html; charset=utf-8"
+		}
+		if redirect {
+			http.Redirect(w, r, target, http.StatusFound)
+			return
+		}
+		body, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// redirect makes from redirect to target.
+func (s *site) redirect(from, target string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.redirects[from] = target
+}
+
+// serveAs makes path be served with the given Content-Type instead of
+// text/html.
+func (s *site) serveAs(path, contentType string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.types[path] = contentType
+}
+
+// hitCount returns how many times path was requested.
+func (s *site) hitCount(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hits[path]
+}
+
+// testConfig returns the default configuration for a crawl of seeds, with
+// no crawl delay and logging discarded.
+func testConfig(seeds ...string) *common.ConfigManager {
+	cfg := config.DefaultConfig()
+	cfg.SeedUrls = seeds
+	cfg.CrawlDelay = 0
+	cfg.StorageType = storage.TypeMemory
+	cfg.Logger = slog.New(slog.DiscardHandler)
+	return cfg
+}
+
+func newTestCrawler(t *testing.T, cfg *common.ConfigManager) (*Crawler, *storage.MemoryStorage) {
+	t.Helper()
+	store := storage.NewMemoryStorage()
+	c, err := NewCrawler(cfg, store)
+	if err != nil {
+		t.Fatalf("NewCrawler: %v", err)
+	}
+	return c, store
+}
+
+// run crawls with c until it finishes, failing the test if that takes
+// more than a few seconds.
+func run(t *testing.T, c *Crawler) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := c.Start(ctx); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	s := newSite(t, map[string]string{
+		"/":  `<a href="/1">1</a>`,
+		"/1": `<a href="/2">2</a>`,
+		"/2": `<a href="/3">3</a>`,
+		"/3": `<title>3</title>`,
+	})
+	cfg := testConfig(s.URL + "/")
+	cfg.MaxDepth = 1
+	c, store := newTestCrawler(t, cfg)
+	run(t, c)
+
+	for path, want := range map[string]int{"/": 1, "/1": 1, "/2": 0, "/3": 0} {
+		if got := s.hitCount(path); got != want {
+			t.Errorf("%s fetched %d times, want %d", path, got, want)
+		}
+	}
+	if n := len(store.Pages()); n != 2 {
+		t.Errorf("stored %d pages, want 2", n)
+	}
+}
+
+func TestResultsReceivesStoredPages(t *testing.T) {
+	s := newSite(t, map[string]string{
+		"/":  `<title>home</title> <a href="/a">a</a>`,
+		"/a": `<title>a</title>`,
+	})
+	c, _ := newTestCrawler(t, testConfig(s.URL+"/"))
+	results := c.Results()
+	done := make(chan struct{})
+	var titles []string
+	go func() {
+		defer close(done)
+		for page := range results {
+			titles = append(titles, page.Title)
+		}
+	}()
+	run(t, c)
+	<-done
+
+	sort.Strings(titles)
+	if strings.Join(titles, " ") != "a home" {
+		t.Errorf("Results() yielded titles %q, want a and home", titles)
+	}
+	if err := c.Start(context.Background()); err == nil {
+		t.Error("second Start succeeded")
+	}
+}
+
+func TestExternalLinksNotFollowed(t *testing.T) {
+	external := newSite(t, map[string]string{"/": `<title>external</title>`})
+	// The external site is reached as localhost, a different domain from
+	// the 127.0.0.1 seed.
+	externalURL := strings.Replace(external.URL, "127.0.0.1", "localhost", 1) + "/"
+	s := newSite(t, map[string]string{
+		"/":  `<a href="/a">a</a> <a href="` + externalURL + `">external</a>`,
+		"/a": `<title>a</title>`,
+	})
+	c, store := newTestCrawler(t, testConfig(s.URL+"/"))
+	run(t, c)
+
+	if n := external.hitCount("/"); n != 0 {
+		t.Errorf("external page fetched %d times", n)
+	}
+	if n := len(store.Pages()); n != 2 {
+		t.Errorf("stored %d pages, want 2", n)
+	}
+	if n := c.Rejected(); n != 1 {
+		t.Errorf("Rejected() = %d, want 1", n)
+	}
+}
+
+func TestRecordAllLinks(t *testing.T) {
+	external := newSite(t, map[string]string{"/": `<title>external</title>`})
+	externalURL := strings.Replace(external.URL, "127.0.0.1", "localhost", 1) + "/"
+	s := newSite(t, map[string]string{
+		"/":  `<a href="/a">a</a> <a href="` + externalURL + `">external</a>`,
+		"/a": `<title>a</title>`,
+	})
+	cfg := testConfig(s.URL + "/")
+	cfg.RecordAllLinks = true
+	c, store := newTestCrawler(t, cfg)
+	run(t, c)
+
+	seed, ok := store.Get(s.URL + "/")
+	if !ok {
+		t.Fatal("seed not stored")
+	}
+	if got, want := strings.Join(seed.Links, " "), s.URL+"/a "+externalURL; got != want {
+		t.Errorf("Links = %q, want %q", got, want)
+	}
+	if n := external.hitCount("/"); n != 0 {
+		t.Errorf("recorded external link fetched %d times", n)
+	}
+	if page, _ := store.Get(s.URL + "/a"); page.Links != nil {
+		t.Errorf("page without links has Links %q", page.Links)
+	}
+
+	// Without the option no links are kept.
+	c, store = newTestCrawler(t, testConfig(s.URL+"/"))
+	run(t, c)
+	if seed, _ := store.Get(s.URL + "/"); seed.Links != nil || seed.LinkCount != 2 {
+		t.Errorf("Links = %q and LinkCount = %d without record_all_links, want none and 2", seed.Links, seed.LinkCount)
+	}
+}
+
+func TestJobsRoutedToTheirStorage(t *testing.T) {
+	blog := newSite(t, map[string]string{
+		"/":            `<a href="/post">post</a> <a href="/drafts/next">draft</a>`,
+		"/post":        `<title>post</title>`,
+		"/drafts/next": `<title>draft</title>`,
+	})
+	// The blog is reached as localhost, a different domain from the docs.
+	blogURL := strings.Replace(blog.URL, "127.0.0.1", "localhost", 1)
+	docs := newSite(t, map[string]string{
+		"/":      `<a href="/guide">guide</a> <a href="` + blogURL + `/post">blog</a>`,
+		"/guide": `<title>guide</title>`,
+	})
+	cfg := testConfig()
+	docsStore, blogStore := storage.NewMemoryStorage(), storage.NewMemoryStorage()
+	c, err := NewJobCrawler(cfg, []Job{
+		{ID: "docs", Config: config.ForJob(cfg, common.JobConfig{ID: "docs", SeedUrls: []string{docs.URL + "/"}}), Storage: docsStore},
+		{ID: "blog", Config: config.ForJob(cfg, common.JobConfig{ID: "blog", SeedUrls: []string{blogURL + "/"}, ExcludePatterns: []string{`/drafts/`}}), Storage: blogStore},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	run(t, c)
+
+	for _, tt := range []struct {
+		id    string
+		store *storage.MemoryStorage
+		want  []string
+	}{
+		{"docs", docsStore, []string{docs.URL + "/", docs.URL + "/guide"}},
+		{"blog", blogStore, []string{blogURL + "/", blogURL + "/post"}},
+	} {
+		pages := tt.store.Pages()
+		if len(pages) != len(tt.want) {
+			t.Errorf("job %s stored %d pages, want %v", tt.id, len(pages), tt.want)
+		}
+		for _, url := range tt.want {
+			if page, ok := tt.store.Get(url); !ok {
+				t.Errorf("job %s did not store %s", tt.id, url)
+			} else if page.JobID != tt.id {
+				t.Errorf("%s tagged with job %q, want %q", url, page.JobID, tt.id)
+			}
+		}
+	}
+	// The docs link to the blog is off the docs job's domain.
+	if n := blog.hitCount("/post"); n != 1 {
+		t.Errorf("blog post fetched %d times, want once by the blog job", n)
+	}
+	if n := blog.hitCount("/drafts/next"); n != 0 {
+		t.Errorf("page excluded by the blog job fetched %d times", n)
+	}
+}
+
+func TestInvalidJobPatternFailsNewJobCrawler(t *testing.T) {
+	cfg := testConfig()
+	_, err := NewJobCrawler(cfg, []Job{
+		{ID: "docs", Config: config.ForJob(cfg, common.JobConfig{ID: "docs", SeedUrls: []string{"http://docs.example/"}})},
+		{ID: "blog", Config: config.ForJob(cfg, common.JobConfig{ID: "blog", SeedUrls: []string{"http://blog.example/"}, IncludePatterns: []string{`(unclosed`}})},
+	})
+	if err == nil || !strings.Contains(err.Error(), "job blog: invalid include pattern") {
+		t.Errorf("NewJobCrawler error = %v, want the blog job's invalid include pattern", err)
+	}
+}
+
+func TestGzipPageLinksFollowed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Encoding", "gzip")
+			gz := gzip.NewWriter(w)
+			gz.Write([]byte(`<title>home</title><a href="/a">a</a>`))
+			gz.Close()
+		case "/a":
+			w.Write([]byte(`<title>a</title>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	c, store := newTestCrawler(t, testConfig(srv.URL+"/"))
+	run(t, c)
+
+	if page, _ := store.Get(srv.URL + "/"); page.Title != "home" || page.LinkCount != 1 {
+		t.Errorf("gzipped page stored with title %q and %d links", page.Title, page.LinkCount)
+	}
+	if _, ok := store.Get(srv.URL + "/a"); !ok {
+		t.Error("link on the gzipped page not crawled")
+	}
+}
+
+func TestMaxPages(t *testing.T) {
+	pages := map[string]string{}
+	var links strings.Builder
+	for i := 1; i < 20; i++ {
+		path := fmt.Sprintf("/%d", i)
+		fmt.Fprintf(&links, `<a href="%s">%d</a> `, path, i)
+		// Even pages are copies of each other, which are not stored and so
+		// must not use up the limit.
+		if i%2 == 0 {
+			pages[path] = `<title>copy</title>`
+		} else {
+			pages[path] = `<title>` + path + `</title>`
+		}
+	}
+	pages["/"] = links.String()
+	s := newSite(t, pages)
+	for range 5 {
+		cfg := testConfig(s.URL + "/")
+		cfg.MaxPages = 5
+		cfg.NumWorkers = 8
+		c, store := newTestCrawler(t, cfg)
+		run(t, c)
+		if n := len(store.Pages()); n != 5 {
+			t.Fatalf("stored %d pages with max_pages 5", n)
+		}
+		if n := c.Stats().PagesStored; n != 5 {
+			t.Fatalf("PagesStored = %d, want 5", n)
+		}
+	}
+}
+
+func TestCircuitBreakerPausesFailingHost(t *testing.T) {
+	const cooldown = 200 * time.Millisecond
+	var mu sync.Mutex
+	var failures int
+	var failedAt, recoveredAt time.Time
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<a href="/1">1</a> <a href="/2">2</a> <a href="/3">3</a> <a href="/4">4</a> <a href="/5">5</a>`))
+			return
+		case "/robots.txt":
+			http.NotFound(w, r)
+			return
+		}
+		// The host is down for its first two pages, then recovers.
+		mu.Lock()
+		defer mu.Unlock()
+		if failures < 2 {
+			failures++
+			failedAt = time.Now()
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		if recoveredAt.IsZero() {
+			recoveredAt = time.Now()
+		}
+		w.Write([]byte("<title>" + r.URL.Path + "</title>"))
+	}))
+	defer srv.Close()
+	cfg := testConfig(srv.URL + "/")
+	cfg.NumWorkers = 1
+	cfg.MaxRetries = 0
+	cfg.BreakerThreshold = 2
+	cfg.BreakerCooldown = cooldown
+	c, store := newTestCrawler(t, cfg)
+	run(t, c)
+
+	if gap := recoveredAt.Sub(failedAt); gap < cooldown {
+		t.Errorf("host fetched again %v after failing twice, want at least the %v cooldown", gap, cooldown)
+	}
+	if n := len(store.Pages()); n != 4 {
+		t.Errorf("stored %d pages, want the seed and the three pages after recovery", n)
+	}
+	host := strings.TrimPrefix(srv.URL, "http://")
+	if errs := c.HostErrors(); errs[host] != 2 {
+		t.Errorf("HostErrors() = %v, want 2 for %s", errs, host)
+	}
+}
+
+func TestCancelStopsWorkers(t *testing.T) {
+	started := make(chan struct{}, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		// Every page links to two more and hangs until the crawl gives up
+		// on it.
+		started <- struct{}{}
+		w.Header().Set("Content-Type", "text/html")
+		path := strings.TrimSuffix(r.URL.Path, "/")
+		fmt.Fprintf(w, `<a href="%[1]s/a">a</a> <a href="%[1]s/b">b</a>`, path)
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+	c, _ := newTestCrawler(t, testConfig(srv.URL+"/"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- c.Start(ctx) }()
+	<-started
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Start returned %v, want context.Canceled", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Start did not return within 2s of cancelling")
+	}
+}
+
+func TestSitemapIndex(t *testing.T) {
+	pages := map[string]string{"/": `<title>home</title>`}
+	s := newSite(t, pages)
+	urlset := func(paths ...string) string {
+		var b strings.Builder
+		b.WriteString(`<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`)
+		for _, p := range paths {
+			fmt.Fprintf(&b, "<url><loc>%s%s</loc></url>", s.URL, p)
+		}
+		return b.String() + "</urlset>"
+	}
+	index := func(paths ...string) string {
+		var b strings.Builder
+		b.WriteString(`<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`)
+		for _, p := range paths {
+			fmt.Fprintf(&b, "<sitemap><loc>%s%s</loc></sitemap>", s.URL, p)
+		}
+		return b.String() + "</sitemapindex>"
+	}
+	pages["/sitemap.xml"] = index("/sitemaps/posts.xml", "/sitemaps/about.xml")
+	pages["/sitemaps/posts.xml"] = index("/sitemaps/posts-1.xml")
+	pages["/sitemaps/posts-1.xml"] = urlset("/posts/1", "/posts/2")
+	pages["/sitemaps/about.xml"] = urlset("/about")
+	for _, p := range []string{"/posts/1", "/posts/2", "/about"} {
+		pages[p] = `<title>` + p + `</title>`
+	}
+
+	cfg := testConfig(s.URL + "/")
+	cfg.UseSitemap = true
+	c, store := newTestCrawler(t, cfg)
+	run(t, c)
+
+	for _, p := range []string{"/", "/posts/1", "/posts/2", "/about"} {
+		if _, ok := store.Get(s.URL + p); !ok {
+			t.Errorf("%s not stored", p)
+		}
+	}
+	if n := len(store.Pages()); n != 4 {
+		t.Errorf("stored %d pages, want 4", n)
+	}
+}
+
+func TestDuplicateContentStoredOnce(t *testing.T) {
+	const body = `<title>same</title><p>identical page</p>`
+	s := newSite(t, map[string]string{
+		"/":      `<a href="/copy1">1</a> <a href="/copy2">2</a>`,
+		"/copy1": body,
+		"/copy2": body,
+	})
+	c, store := newTestCrawler(t, testConfig(s.URL+"/"))
+	run(t, c)
+
+	if n := len(store.Pages()); n != 2 {
+		t.Fatalf("stored %d pages, want the seed and one copy", n)
+	}
+	first, second := s.URL+"/copy1", s.URL+"/copy2"
+	if _, ok := store.Get(first); !ok {
+		first, second = second, first
+	}
+	if original, ok := store.Alias(second); !ok || original != first {
+		t.Errorf("Alias(%s) = %q, %v; want %s", second, original, ok, first)
+	}
+}
+
+func TestCanonicalVariantsStoredOnce(t *testing.T) {
+	// Both variants declare /article as canonical but differ in content,
+	// so only the canonical link ties them together.
+	const canonical = `<link rel="canonical" href="/article">`
+	s := newSite(t, map[string]string{
+		"/":              `<a href="/article?page=1">1</a> <a href="/print/article">2</a>`,
+		"/article":       canonical + `<title>article</title>`,
+		"/print/article": canonical + `<title>article, printable</title>`,
+	})
+	c, store := newTestCrawler(t, testConfig(s.URL+"/"))
+	run(t, c)
+
+	if n := len(store.Pages()); n != 2 {
+		t.Errorf("stored %d pages, want the seed and one article", n)
+	}
+	if _, ok := store.Get(s.URL + "/article"); !ok {
+		t.Error("article not stored under its canonical URL")
+	}
+	for _, variant := range []string{"/article?page=1", "/print/article"} {
+		if original, ok := store.Alias(s.URL + variant); !ok || original != s.URL+"/article" {
+			t.Errorf("Alias(%s) = %q, %v; want the canonical URL", variant, original, ok)
+		}
+	}
+}
+
+func TestRedirectTargetsFiltered(t *testing.T) {
+	external := newSite(t, map[string]string{"/": `<title>external</title>`})
+	externalURL := strings.Replace(external.URL, "127.0.0.1", "localhost", 1) + "/"
+	s := newSite(t, map[string]string{
+		"/":     `<a href="/away">away</a> <a href="/moved">moved</a> <a href="/hop">hop</a> <a href="/loop1">loop</a>`,
+		"/here": `<title>here</title>`,
+	})
+	s.redirect("/away", externalURL)
+	s.redirect("/moved", "/here")
+	// A chain through an off-site hop stops there, even if it would come
+	// back, and so does a loop.
+	s.redirect("/hop", externalURL+"back")
+	external.redirect("/back", s.URL+"/elsewhere")
+	s.redirect("/loop1", "/loop2")
+	s.redirect("/loop2", "/loop1")
+	c, store := newTestCrawler(t, testConfig(s.URL+"/"))
+	run(t, c)
+
+	if n := external.hitCount("/") + external.hitCount("/back"); n != 0 {
+		t.Errorf("off-site redirect targets requested %d times, want 0", n)
+	}
+	if s.hitCount("/elsewhere") != 0 {
+		t.Error("chain continued past an off-site hop")
+	}
+	if n := s.hitCount("/loop1"); n != 1 {
+		t.Errorf("/loop1 requested %d times, want 1", n)
+	}
+
+	if _, ok := store.Get(s.URL + "/here"); !ok {
+		t.Error("page reached by an on-site redirect not stored")
+	}
+	for _, page := range store.Pages() {
+		if strings.Contains(page.URL, "localhost") || page.Title == "external" {
+			t.Errorf("stored %s, reached by redirecting off-site", page.URL)
+		}
+	}
+	if n := len(store.Pages()); n != 2 {
+		t.Errorf("stored %d pages, want 2", n)
+	}
+}
+
+func TestUnwantedContentTypeSkipped(t *testing.T) {
+	s := newSite(t, map[string]string{
+		"/":        `<a href="/doc.pdf">doc</a>`,
+		"/doc.pdf": `<a href="/hidden">a link inside a binary</a>`,
+		"/hidden":  `<title>hidden</title>`,
+	})
+	s.serveAs("/doc.pdf", "application/pdf")
+	c, store := newTestCrawler(t, testConfig(s.URL+"/"))
+	run(t, c)
+
+	if _, ok := store.Get(s.URL + "/doc.pdf"); ok {
+		t.Error("PDF stored")
+	}
+	if n := s.hitCount("/hidden"); n != 0 {
+		t.Errorf("link in the PDF fetched %d times", n)
+	}
+	if n := len(store.Pages()); n != 1 {
+		t.Errorf("stored %d pages, want 1", n)
+	}
+}
+
+func TestDryRunStoresNothing(t *testing.T) {
+	s := newSite(t, map[string]string{
+		"/":  `<a href="/a">a</a>`,
+		"/a": `<title>a</title>`,
+	})
+	cfg := testConfig(s.URL + "/")
+	cfg.DryRun = true
+	// A state file with an empty queue would end a real crawl at once.
+	cfg.StateFile = filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(cfg.StateFile, []byte(`{"queue": [], "visited": []}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c, store := newTestCrawler(t, cfg)
+	results := c.Results()
+	var seen []string
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for page := range results {
+			seen = append(seen, page.URL)
+		}
+	}()
+	run(t, c)
+	<-done
+
+	if n := len(store.Pages()); n != 0 {
+		t.Errorf("dry run stored %d pages", n)
+	}
+	if len(seen) != 2 {
+		t.Errorf("Results() yielded %v, want both pages", seen)
+	}
+	if _, err := os.Stat(cfg.StateFile); err != nil {
+		t.Errorf("dry run removed the state file: %v", err)
+	}
+}
+
+func TestNotModifiedKeepsStoredPage(t *testing.T) {
+	var conditional atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("If-None-Match") == `"v1"` && r.Header.Get("If-Modified-Since") == "Mon, 02 Jan 2006 15:04:05 GMT" {
+			conditional.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("ETag", `"v2"`)
+		w.Write([]byte(`<title>changed</title>`))
+	}))
+	defer srv.Close()
+
+	cfg := testConfig(srv.URL + "/")
+	c, store := newTestCrawler(t, cfg)
+	earlier := common.PageStorageData{URL: srv.URL + "/", Title: "original", ETag: `"v1"`, LastModified: "Mon, 02 Jan 2006 15:04:05 GMT"}
+	if err := store.Save(context.Background(), earlier); err != nil {
+		t.Fatal(err)
+	}
+	run(t, c)
+
+	if n := conditional.Load(); n != 1 {
+		t.Errorf("server answered %d conditional requests with 304, want 1", n)
+	}
+	if page, _ := store.Get(srv.URL + "/"); page.Title != "original" || page.ETag != `"v1"` {
+		t.Errorf("stored page overwritten: title %q, ETag %s", page.Title, page.ETag)
+	}
+	if n := c.Stats().PagesStored; n != 0 {
+		t.Errorf("PagesStored = %d, want 0", n)
+	}
+}
+
+func TestStatsCountServedPages(t *testing.T) {
+	pages := map[string]string{
+		"/":  `<a href="/a">a</a> <a href="/b">b</a> <a href="/missing">missing</a>`,
+		"/a": `<a href="/">home</a> <a href="/c">c</a>`,
+		"/b": `<title>b</title>`,
+		"/c": `<title>c</title>`,
+	}
+	s := newSite(t, pages)
+	c, _ := newTestCrawler(t, testConfig(s.URL+"/"))
+	run(t, c)
+
+	stats := c.Stats()
+	if stats.PagesFetched != len(pages) || stats.PagesStored != len(pages) {
+		t.Errorf("fetched %d and stored %d pages, want %d", stats.PagesFetched, stats.PagesStored, len(pages))
+	}
+	if stats.Errors != 1 {
+		t.Errorf("Errors = %d, want 1 for the missing page", stats.Errors)
+	}
+	var bytes int64
+	for _, body := range pages {
+		bytes += int64(len(body))
+	}
+	if stats.BytesDownloaded != bytes || stats.UniqueHosts != 1 || stats.Duration <= 0 {
+		t.Errorf("got %d bytes from %d hosts in %v, want %d bytes from 1 host", stats.BytesDownloaded, stats.UniqueHosts, stats.Duration, bytes)
+	}
+}
+
+func TestRateLimitSpacesRequests(t *testing.T) {
+	var mu sync.Mutex
+	var times []time.Time
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		mu.Lock()
+		times = append(times, time.Now())
+		mu.Unlock()
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/" {
+			for i := range 5 {
+				fmt.Fprintf(w, `<a href="/%d">%d</a>`, i, i)
+			}
+		}
+	}))
+	defer srv.Close()
+
+	cfg := testConfig(srv.URL + "/")
+	cfg.NumWorkers = 4
+	cfg.MaxPerHost = 4
+	cfg.RequestsPerSecond = 20
+	cfg.Burst = 1
+	c, _ := newTestCrawler(t, cfg)
+	run(t, c)
+
+	if len(times) != 6 {
+		t.Fatalf("server saw %d page requests, want 6", len(times))
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	// 20 requests per second with no burst leaves 50ms between requests;
+	// allow for timer slack.
+	for i := 1; i < len(times); i++ {
+		if gap := times[i].Sub(times[i-1]); gap < 40*time.Millisecond {
+			t.Errorf("request %d came %v after the previous one, want about 50ms", i, gap)
+		}
+	}
+}
+
+// scrapeMetrics fetches /metrics from a metrics server on port, retrying
+// while it starts up, and returns the unlabelled samples by name.
+func scrapeMetrics(t *testing.T, port int) map[string]float64 {
+	t.Helper()
+	var resp *http.Response
+	var err error
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		resp, err = http.Get(fmt.Sprintf("http://127.0.0.1:%d/metrics", port))
+		if err == nil || time.Now().After(deadline) {
+			break
+		}
+	}
+	if err != nil {
+		t.Fatalf("scraping metrics: %v", err)
+	}
+	defer resp.Body.Close()
+	samples := make(map[string]float64)
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		name, value, ok := strings.Cut(scanner.Text(), " ")
+		if !ok || strings.HasPrefix(name, "#") || strings.Contains(name, "{") {
+			continue
+		}
+		if v, err := strconv.ParseFloat(value, 64); err == nil {
+			samples[name] = v
+		}
+	}
+	return samples
+}
+
+func TestMetricsScrapedAfterCrawl(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+	srv := metrics.StartServer(port, slog.New(slog.DiscardHandler))
+	defer srv.Shutdown(context.Background())
+
+	s := newSite(t, map[string]string{
+		"/":  `<a href="/a">a</a> <a href="/b">b</a> <a href="/missing">missing</a>`,
+		"/a": `<title>a</title>`,
+		"/b": `<title>b</title>`,
+	})
+	// Counters are shared by every test in the package, so only the change
+	// made by this crawl is checked.
+	before := scrapeMetrics(t, port)
+	c, _ := newTestCrawler(t, testConfig(s.URL+"/"))
+	run(t, c)
+	after := scrapeMetrics(t, port)
+
+	deltas := map[string]float64{
+		"crawler_pages_fetched_total":   3,
+		"crawler_pages_stored_total":    3,
+		"crawler_fetch_errors_total":    1,
+		"crawler_urls_discovered_total": 4,
+	}
+	for name, want := range deltas {
+		if got := after[name] - before[name]; got != want {
+			t.Errorf("%s rose by %v, want %v", name, got, want)
+		}
+	}
+	// The gauges total every manager, including those of earlier tests
+	// stopped with URLs still queued, so a finished crawl leaves them as
+	// they were.
+	for _, name := range []string{"crawler_queue_length", "crawler_in_flight_workers"} {
+		if _, ok := after[name]; !ok {
+			t.Errorf("%s not exported", name)
+		} else if after[name] != before[name] {
+			t.Errorf("%s went from %v to %v over a finished crawl", name, before[name], after[name])
+		}
+	}
+}
+
+func TestPageLanguage(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<a href="/attr">attr</a> <a href="/header">header</a> <a href="/both">both</a>`))
+		case "/attr":
+			w.Write([]byte(`<html lang="fr-ca"><title>attr</title></html>`))
+		case "/header":
+			w.Header().Set("Content-Language", "de_DE, en")
+			w.Write([]byte(`<title>header</title>`))
+		case "/both":
+			// The document's own declaration beats the header.
+			w.Header().Set("Content-Language", "de")
+			w.Write([]byte(`<html lang="nl"><title>both</title></html>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	c, store := newTestCrawler(t, testConfig(srv.URL+"/"))
+	run(t, c)
+
+	for path, want := range map[string]string{"/": "", "/attr": "fr-CA", "/header": "de-DE", "/both": "nl"} {
+		page, ok := store.Get(srv.URL + path)
+		if !ok {
+			t.Errorf("%s not stored", path)
+			continue
+		}
+		if page.Language != want {
+			t.Errorf("%s: Language = %q, want %q", path, page.Language, want)
+		}
+	}
+}
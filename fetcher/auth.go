@@ -0,0 +1,66 @@
+package fetcher
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"crawler/common"
+)
+
+// authenticator adds the configured credentials to requests for the hosts
+// they are meant for.
+type authenticator struct {
+	user, pass string
+	token      string
+	hosts      []string
+}
+
+// newAuthenticator returns nil when cfg has no credentials. Without
+// cfg.AuthHosts, credentials are only sent to the seed hosts.
+func newAuthenticator(cfg *common.ConfigManager) *authenticator {
+	if cfg.BasicAuthUser == "" && cfg.BearerToken == "" {
+		return nil
+	}
+	a := &authenticator{user: cfg.BasicAuthUser, pass: cfg.BasicAuthPass, token: cfg.BearerToken}
+	for _, h := range cfg.AuthHosts {
+		if h = strings.ToLower(strings.TrimSpace(h)); h != "" {
+			a.hosts = append(a.hosts, h)
+		}
+	}
+	if len(a.hosts) == 0 {
+		for _, seed := range cfg.SeedUrls {
+			if u, err := url.Parse(seed); err == nil && u.Hostname() != "" {
+				a.hosts = append(a.hosts, strings.ToLower(u.Hostname()))
+			}
+		}
+	}
+	return a
+}
+
+// apply sets the Authorization header of req if its host matches one of
+// the patterns: an exact host, or "*.example.com" for example.com and its
+// subdomains.
+func (a *authenticator) apply(req *http.Request) {
+	if a == nil || !a.matches(strings.ToLower(req.URL.Hostname())) {
+		return
+	}
+	if a.token != "" {
+		req.Header.Set("Authorization", "Bearer "+a.token)
+	} else {
+		req.SetBasicAuth(a.user, a.pass)
+	}
+}
+
+func (a *authenticator) matches(host string) bool {
+	for _, pattern := range a.hosts {
+		if domain, ok := strings.CutPrefix(pattern, "*."); ok {
+			if host == domain || strings.HasSuffix(host, "."+domain) {
+				return true
+			}
+		} else if host == pattern {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"time"
+
+	"crawler/common"
+)
+
+// ErrTooManyRedirects is wrapped by fetch errors for requests that
+// redirected more than cfg.MaxRedirects times.
+var ErrTooManyRedirects = errors.New("too many redirects")
+
+// RedirectCheck vets one redirect hop before it is followed, returning why
+// the request must not go from from to to, or "" to follow it.
+type RedirectCheck func(ctx context.Context, from, to string) string
+
+type redirectCheckKey struct{}
+
+// WithRedirectCheck returns a copy of ctx that makes requests sent with it
+// by a client from NewClient run check on every redirect hop.
+func WithRedirectCheck(ctx context.Context, check RedirectCheck) context.Context {
+	return context.WithValue(ctx, redirectCheckKey{}, check)
+}
+
+// NewClient builds the HTTP client shared by every worker so connections
+// are pooled across them. Requests go through cfg.ProxyURL when set, which
+// config.ValidateProxyURL is expected to have checked, and otherwise through
+// the proxy named by the environment. At most cfg.MaxRedirects redirects
+// are followed per request, each first passed to the request's
+// RedirectCheck, if any; a hop that leaves the original host drops
+// cfg.Headers and any Authorization, which is set again only if the new
+// host is one the credentials are meant for. With cfg.EnableCookies the client keeps a cookie
+// jar; a cfg.CookieFile that cannot be read is logged and left out.
+func NewClient(cfg *common.ConfigManager) *http.Client {
+	proxy := http.ProxyFromEnvironment
+	if cfg.ProxyURL != "" {
+		if u, err := url.Parse(cfg.ProxyURL); err == nil {
+			proxy = http.ProxyURL(u)
+		}
+	}
+	idlePerHost := int(cfg.MaxPerHost)
+	if idlePerHost == 0 {
+		// No per-host limit: any worker may be talking to the host.
+		idlePerHost = int(cfg.NumWorkers)
+	}
+	transport := &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   10 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          cfg.MaxIdleConns,
+		MaxIdleConnsPerHost:   idlePerHost,
+		IdleConnTimeout:       cfg.IdleConnTimeout,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	auth := newAuthenticator(cfg)
+	var jar http.CookieJar
+	if cfg.EnableCookies {
+		j, err := newCookieJar(cfg.CookieFile)
+		if err != nil {
+			cfg.Log().Error("loading cookies failed", "error", err)
+			j, _ = newCookieJar("")
+		}
+		jar = j
+	}
+	return &http.Client{
+		Transport: transport,
+		Jar:       jar,
+		Timeout:   cfg.HTTPTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > int(cfg.MaxRedirects) {
+				return fmt.Errorf("%w: stopped after %d", ErrTooManyRedirects, cfg.MaxRedirects)
+			}
+			from, to := via[len(via)-1].URL.String(), req.URL.String()
+			if check, ok := req.Context().Value(redirectCheckKey{}).(RedirectCheck); ok {
+				if reason := check(req.Context(), from, to); reason != "" {
+					return &RedirectError{From: from, To: to, Reason: reason}
+				}
+			}
+			if !strings.EqualFold(req.URL.Host, via[0].URL.Host) {
+				// The client copies every header of the first request.
+				for name := range cfg.Headers {
+					if name = textproto.CanonicalMIMEHeaderKey(name); name != "User-Agent" {
+						req.Header.Del(name)
+					}
+				}
+				req.Header.Del("Authorization")
+				auth.apply(req)
+			}
+			return nil
+		},
+	}
+}
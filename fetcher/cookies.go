@@ -0,0 +1,90 @@
+package fetcher
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// newCookieJar returns a jar holding the cookies of the Netscape-format
+// cookieFile, or an empty jar when cookieFile is empty.
+func newCookieJar(cookieFile string) (*cookiejar.Jar, error) {
+	jar, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	if err != nil {
+		return nil, err
+	}
+	if cookieFile == "" {
+		return jar, nil
+	}
+	f, err := os.Open(cookieFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading cookie file: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		// Only the line ending is trimmed: a trailing tab ends an empty
+		// value, and values may start or end with spaces.
+		text := strings.TrimRight(scanner.Text(), "\r\n")
+		httpOnly := false
+		if rest, ok := strings.CutPrefix(text, "#HttpOnly_"); ok {
+			text, httpOnly = rest, true
+		}
+		if strings.TrimSpace(text) == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		u, cookie, err := parseCookieLine(text)
+		if err != nil {
+			return nil, fmt.Errorf("reading cookie file %s:%d: %w", cookieFile, line, err)
+		}
+		cookie.HttpOnly = httpOnly
+		jar.SetCookies(u, []*http.Cookie{cookie})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading cookie file: %w", err)
+	}
+	return jar, nil
+}
+
+// parseCookieLine parses one tab-separated cookie file entry: domain,
+// subdomain flag, path, secure flag, expiry as a Unix time, name and value.
+// It returns the URL the cookie is set for.
+func parseCookieLine(line string) (*url.URL, *http.Cookie, error) {
+	fields := strings.Split(line, "\t")
+	if len(fields) != 7 {
+		return nil, nil, fmt.Errorf("expected 7 tab-separated fields, got %d", len(fields))
+	}
+	domain, includeSubdomains, path, secure, expiry, name, value := fields[0], fields[1], fields[2], fields[3], fields[4], fields[5], fields[6]
+	expires, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid expiry %q", expiry)
+	}
+
+	host := strings.TrimPrefix(domain, ".")
+	cookie := &http.Cookie{
+		Name:   name,
+		Value:  value,
+		Path:   path,
+		Secure: strings.EqualFold(secure, "TRUE"),
+	}
+	if strings.EqualFold(includeSubdomains, "TRUE") {
+		cookie.Domain = host
+	}
+	if expires > 0 {
+		cookie.Expires = time.Unix(expires, 0)
+	}
+	scheme := "http"
+	if cookie.Secure {
+		scheme = "https"
+	}
+	return &url.URL{Scheme: scheme, Host: host, Path: path}, cookie, nil
+}
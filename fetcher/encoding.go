@@ -0,0 +1,69 @@
+package fetcher
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// acceptEncoding is sent with every request. Setting it ourselves turns off
+// the transport's own gzip handling, so decodeBody covers every encoding.
+const acceptEncoding = "gzip, deflate, br"
+
+// decodeBody returns resp's body with its Content-Encoding undone. Bodies
+// without one, or marked identity, are returned as is. Encodings are undone
+// last applied first, as the header lists them in the order applied.
+func decodeBody(resp *http.Response) (io.Reader, error) {
+	var r io.Reader = resp.Body
+	codings := strings.Split(resp.Header.Get("Content-Encoding"), ",")
+	for i := len(codings) - 1; i >= 0; i-- {
+		var err error
+		switch coding := strings.ToLower(strings.TrimSpace(codings[i])); coding {
+		case "", "identity":
+		case "gzip", "x-gzip":
+			r, err = newGzipReader(r)
+		case "deflate":
+			r, err = newDeflateReader(r)
+		case "br":
+			r = brotli.NewReader(r)
+		default:
+			return nil, fmt.Errorf("unsupported content encoding %q", coding)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("decoding %s body: %w", codings[i], err)
+		}
+	}
+	return r, nil
+}
+
+// newGzipReader decodes a gzip stream, or passes r through when it does not
+// start with the gzip magic number: some servers label plain bodies gzip.
+func newGzipReader(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(2)
+	if err != nil || magic[0] != 0x1f || magic[1] != 0x8b {
+		return br, nil
+	}
+	return gzip.NewReader(br)
+}
+
+// newDeflateReader decodes "deflate" bodies, which should be zlib streams
+// but are sent as raw DEFLATE data by some servers.
+func newDeflateReader(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(2)
+	if err != nil {
+		return br, nil
+	}
+	if header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
@@ -0,0 +1,111 @@
+package fetcher
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+const page = `<html><title>compressed</title><a href="/next">next</a></html>`
+
+// compress returns page encoded with coding, a Content-Encoding value.
+func compress(t *testing.T, coding string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch coding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	case "raw deflate":
+		w, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+	case "br":
+		w = brotli.NewWriter(&buf)
+	default:
+		return []byte(page)
+	}
+	w.Write([]byte(page))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCompressedResponses(t *testing.T) {
+	tests := []struct {
+		name, encoding string
+		body           []byte
+	}{
+		{"gzip", "gzip", compress(t, "gzip")},
+		{"deflate", "deflate", compress(t, "deflate")},
+		{"raw deflate", "deflate", compress(t, "raw deflate")},
+		{"brotli", "br", compress(t, "br")},
+		{"identity", "", []byte(page)},
+		{"plain body labelled gzip", "gzip", []byte(page)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if got := r.Header.Get("Accept-Encoding"); got != acceptEncoding {
+					t.Errorf("Accept-Encoding = %q, want %q", got, acceptEncoding)
+				}
+				w.Header().Set("Content-Type", "text/html")
+				if tt.encoding != "" {
+					w.Header().Set("Content-Encoding", tt.encoding)
+				}
+				w.Write(tt.body)
+			}))
+			defer srv.Close()
+
+			got, err := newTestFetcher(testConfig()).Fetch(context.Background(), srv.URL)
+			if err != nil {
+				t.Fatalf("Fetch: %v", err)
+			}
+			if string(got.Body) != page {
+				t.Errorf("body = %q, want the decoded page", got.Body)
+			}
+		})
+	}
+}
+
+func TestUnsupportedContentEncoding(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Content-Encoding", "zstd")
+		w.Write([]byte("(\xb5/\xfd"))
+	}))
+	defer srv.Close()
+	if _, err := newTestFetcher(testConfig()).Fetch(context.Background(), srv.URL); err == nil {
+		t.Error("Fetch decoded a zstd body it does not support")
+	}
+}
+
+func TestMaxBodyBytesAppliesDecoded(t *testing.T) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(make([]byte, 1<<20))
+	w.Close()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(buf.Bytes())
+	}))
+	defer srv.Close()
+
+	cfg := testConfig()
+	cfg.MaxBodyBytes = 64 << 10
+	// The compressed body is well under the limit, its content is not.
+	if _, err := newTestFetcher(cfg).Fetch(context.Background(), srv.URL); !errors.Is(err, ErrBodyTooLarge) {
+		t.Errorf("Fetch error = %v, want ErrBodyTooLarge", err)
+	}
+}
@@ -0,0 +1,316 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"crawler/common"
+)
+
+// maxDrain is how much of an oversized body is read and discarded so the
+// connection can be reused. Anything longer is cut off by closing it.
+const maxDrain = 256 << 10
+
+// ErrBodyTooLarge is wrapped by fetch errors for bodies over the configured
+// limit.
+var ErrBodyTooLarge = errors.New("body too large")
+
+// StatusError reports a non-2xx HTTP response.
+type StatusError struct {
+	URL        string
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("fetching %s: unexpected status %s", e.URL, e.Status)
+}
+
+// RedirectError reports a redirect hop rejected by the request's
+// RedirectCheck. The hop is not requested.
+type RedirectError struct {
+	From, To string
+	Reason   string
+}
+
+func (e *RedirectError) Error() string {
+	return fmt.Sprintf("not following redirect from %s to %s: %s", e.From, e.To, e.Reason)
+}
+
+// ContentTypeError reports a response whose media type is not allowed. Its
+// body is not downloaded.
+type ContentTypeError struct {
+	URL         string
+	ContentType string
+}
+
+func (e *ContentTypeError) Error() string {
+	return fmt.Sprintf("fetching %s: content type %q not allowed", e.URL, e.ContentType)
+}
+
+// Fetcher backends accepted by ConfigManager.Fetcher.
+const (
+	FetcherHTTP     = "http"
+	FetcherHeadless = "headless"
+)
+
+// Fetcher downloads a page for the crawler to parse. Failures are returned
+// as the error, a *StatusError for non-2xx responses and a
+// *ContentTypeError for unwanted media types, alongside whatever the
+// response did provide, such as its status and headers. Implementations
+// must be safe for use by several workers at once.
+type Fetcher interface {
+	Fetch(ctx context.Context, url string) (common.FetchedPageData, error)
+}
+
+// ConditionalFetcher is a Fetcher that can skip pages unchanged since an
+// earlier crawl. It is used when storage keeps cache validators.
+type ConditionalFetcher interface {
+	Fetcher
+	FetchIfModified(ctx context.Context, url, etag, lastModified string) (common.FetchedPageData, error)
+}
+
+// HTTPFetcher downloads pages over HTTP, retrying transient failures with
+// exponential backoff.
+type HTTPFetcher struct {
+	client      *http.Client
+	userAgent   string
+	headers     map[string]string
+	auth        *authenticator
+	maxRetries  int
+	baseBackoff time.Duration
+	types       []string
+	maxBody     int64
+	truncate    bool
+	log         *slog.Logger
+}
+
+func NewHTTPFetcher(cfg *common.ConfigManager, client *http.Client) *HTTPFetcher {
+	return &HTTPFetcher{
+		client:      client,
+		userAgent:   cfg.UserAgent,
+		headers:     cfg.Headers,
+		auth:        newAuthenticator(cfg),
+		maxRetries:  int(cfg.MaxRetries),
+		baseBackoff: cfg.BaseBackoff,
+		types:       cfg.ContentTypes,
+		maxBody:     cfg.MaxBodyBytes,
+		truncate:    cfg.TruncateBodies,
+		log:         cfg.Log(),
+	}
+}
+
+// Fetch downloads url and returns its body, following redirects as the
+// client allows; FetchedPageData.FinalURL records where they led. Bodies
+// compressed with gzip, deflate or brotli are decoded. Timeouts,
+// connection resets and 5xx responses are retried up to maxRetries times
+// and the last error is returned. Cancelling ctx aborts the request and
+// any pending retry.
+func (f *HTTPFetcher) Fetch(ctx context.Context, url string) (common.FetchedPageData, error) {
+	return f.FetchIfModified(ctx, url, "", "")
+}
+
+// FetchIfModified is Fetch with If-None-Match and If-Modified-Since set from
+// etag and lastModified when they are not empty. An unchanged page comes
+// back with StatusCode 304, no body and no error.
+func (f *HTTPFetcher) FetchIfModified(ctx context.Context, url, etag, lastModified string) (common.FetchedPageData, error) {
+	for attempt := 0; ; attempt++ {
+		page, err := f.fetchOnce(ctx, url, etag, lastModified)
+		if err == nil || attempt >= f.maxRetries || !retryable(err) || ctx.Err() != nil {
+			return page, err
+		}
+		wait := f.backoff(attempt)
+		f.log.Debug("retrying fetch", "url", url, "attempt", attempt+1, "backoff", wait, "error", err)
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return page, fmt.Errorf("fetching %s: %w", url, ctx.Err())
+		}
+	}
+}
+
+func (f *HTTPFetcher) fetchOnce(ctx context.Context, url, etag, lastModified string) (common.FetchedPageData, error) {
+	page := common.FetchedPageData{URL: url}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return page, fmt.Errorf("building request for %s: %w", url, err)
+	}
+	if f.userAgent != "" {
+		req.Header.Set("User-Agent", f.userAgent)
+	}
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+	for name, value := range f.headers {
+		req.Header.Set(name, value)
+	}
+	f.auth.apply(req)
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	f.log.Debug("fetch start", "url", url)
+	start := time.Now()
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return page, fmt.Errorf("fetching %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	page.Latency = time.Since(start)
+	page.FinalURL = resp.Request.URL.String()
+	defer func() {
+		f.log.Debug("fetch complete", "url", url, "status", resp.StatusCode, "bytes", len(page.Body), "latency", time.Since(start))
+	}()
+
+	page.StatusCode = resp.StatusCode
+	page.ETag = resp.Header.Get("ETag")
+	page.LastModified = resp.Header.Get("Last-Modified")
+	page.Language = resp.Header.Get("Content-Language")
+	if resp.StatusCode == http.StatusNotModified {
+		return page, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		io.Copy(io.Discard, resp.Body)
+		return page, &StatusError{URL: url, StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	// Skipping the body closes the connection instead of returning it to the
+	// pool, which is cheaper than draining a large download.
+	if contentType := resp.Header.Get("Content-Type"); !f.allowsType(contentType) {
+		return page, &ContentTypeError{URL: url, ContentType: contentType}
+	}
+
+	page.Body, err = f.readBody(url, resp)
+	return page, err
+}
+
+// readBody decodes resp's body and reads at most maxBody bytes of it. Longer
+// bodies are an error, or cut off at the limit when truncating.
+func (f *HTTPFetcher) readBody(url string, resp *http.Response) ([]byte, error) {
+	decoded, err := decodeBody(resp)
+	if err != nil {
+		return nil, fmt.Errorf("reading body of %s: %w", url, err)
+	}
+	if f.maxBody <= 0 {
+		body, err := io.ReadAll(decoded)
+		if err != nil {
+			return body, fmt.Errorf("reading body of %s: %w", url, err)
+		}
+		return body, nil
+	}
+	tooLarge := fmt.Errorf("reading body of %s: %w (limit %d bytes)", url, ErrBodyTooLarge, f.maxBody)
+	if !f.truncate && resp.ContentLength > f.maxBody {
+		return nil, tooLarge
+	}
+	body, err := io.ReadAll(io.LimitReader(decoded, f.maxBody+1))
+	if err != nil {
+		return body, fmt.Errorf("reading body of %s: %w", url, err)
+	}
+	if int64(len(body)) <= f.maxBody {
+		return body, nil
+	}
+	io.CopyN(io.Discard, resp.Body, maxDrain)
+	if f.truncate {
+		return body[:f.maxBody], nil
+	}
+	return nil, tooLarge
+}
+
+// allowsType reports whether a response with the given Content-Type header
+// should be downloaded.
+func (f *HTTPFetcher) allowsType(contentType string) bool {
+	return allowsType(f.types, contentType)
+}
+
+// allowsType reports whether contentType matches one of types. Responses
+// without a Content-Type are allowed, as are all responses when types is
+// empty.
+func allowsType(types []string, contentType string) bool {
+	if len(types) == 0 || contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range types {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if family, ok := strings.CutSuffix(t, "/*"); ok {
+			if strings.HasPrefix(mediaType, family+"/") {
+				return true
+			}
+		} else if mediaType == t {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns baseBackoff doubled for every previous attempt, with up
+// to 50% jitter either way so workers don't retry in lockstep.
+func (f *HTTPFetcher) backoff(attempt int) time.Duration {
+	d := f.baseBackoff << attempt
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + rand.N(d)
+}
+
+// HostFailure reports whether err, from a fetch, suggests the host itself is
+// in trouble: a 5xx response or a network error such as a failed DNS lookup,
+// a refused connection or a timeout. Errors about one page, like a 404 or an
+// oversized body, are not.
+func HostFailure(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500
+	}
+	var redirectErr *RedirectError
+	if errors.Is(err, ErrTooManyRedirects) || errors.As(err, &redirectErr) {
+		return false
+	}
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return true
+	}
+	var loadErr *loadError
+	if errors.As(err, &loadErr) {
+		return true
+	}
+	return retryable(err)
+}
+
+// retryable reports whether err is worth another attempt: 5xx responses,
+// timeouts and connections dropped by the server. Other 4xx responses and
+// malformed requests are not.
+func retryable(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF)
+}
@@ -0,0 +1,518 @@
+package fetcher
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"crawler/common"
+	"crawler/config"
+)
+
+// testConfig returns the default configuration with short retry backoffs
+// and logging discarded.
+func testConfig() *common.ConfigManager {
+	cfg := config.DefaultConfig()
+	cfg.BaseBackoff = time.Millisecond
+	cfg.Logger = slog.New(slog.DiscardHandler)
+	return cfg
+}
+
+func newTestFetcher(cfg *common.ConfigManager) *HTTPFetcher {
+	return NewHTTPFetcher(cfg, NewClient(cfg))
+}
+
+func TestFetchRetriesUntilSuccess(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= 2 {
+			http.Error(w, "try again", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<title>ok</title>"))
+	}))
+	defer srv.Close()
+
+	page, err := newTestFetcher(testConfig()).Fetch(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if page.StatusCode != http.StatusOK || string(page.Body) != "<title>ok</title>" {
+		t.Errorf("got status %d and body %q", page.StatusCode, page.Body)
+	}
+	if n := requests.Load(); n != 3 {
+		t.Errorf("server saw %d requests, want 3", n)
+	}
+}
+
+func TestFetchGivesUpAfterMaxRetries(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.Error(w, "down", http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	cfg := testConfig()
+	cfg.MaxRetries = 2
+	_, err := newTestFetcher(cfg).Fetch(context.Background(), srv.URL)
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("Fetch error = %v, want a 500 *StatusError", err)
+	}
+	if n := requests.Load(); n != 3 {
+		t.Errorf("server saw %d requests, want 3", n)
+	}
+}
+
+func TestFetchCancelledDuringBackoff(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	cfg := testConfig()
+	cfg.BaseBackoff = time.Hour
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := newTestFetcher(cfg).Fetch(ctx, srv.URL)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Fetch error = %v, want context.DeadlineExceeded", err)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("server saw %d requests, want 1", n)
+	}
+}
+
+func TestFetchTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer srv.Close()
+
+	cfg := testConfig()
+	cfg.HTTPTimeout = 50 * time.Millisecond
+	cfg.MaxRetries = 0
+	start := time.Now()
+	_, err := newTestFetcher(cfg).Fetch(context.Background(), srv.URL)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Fetch took %v with a 50ms timeout", elapsed)
+	}
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Errorf("Fetch error = %v, want a timeout", err)
+	}
+}
+
+func TestFetchThroughProxy(t *testing.T) {
+	var proxied atomic.Value
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A forward proxy receives the absolute URL of the target.
+		proxied.Store(r.URL.String())
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<title>via proxy</title>"))
+	}))
+	defer proxy.Close()
+
+	cfg := testConfig()
+	cfg.ProxyURL = proxy.URL
+	page, err := newTestFetcher(cfg).Fetch(context.Background(), "http://crawl.example/page")
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if got, _ := proxied.Load().(string); got != "http://crawl.example/page" {
+		t.Errorf("proxy saw %q, want http://crawl.example/page", got)
+	}
+	if string(page.Body) != "<title>via proxy</title>" {
+		t.Errorf("got body %q", page.Body)
+	}
+}
+
+// redirectChain serves /0 redirecting to /1 and so on up to /hops, which is
+// a page.
+func redirectChain(hops int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/"))
+		if n < hops {
+			http.Redirect(w, r, fmt.Sprintf("/%d", n+1), http.StatusFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<title>end</title>"))
+	}))
+}
+
+func TestRedirectLimit(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxRedirects = 2
+	f := newTestFetcher(cfg)
+
+	three := redirectChain(3)
+	defer three.Close()
+	if _, err := f.Fetch(context.Background(), three.URL+"/0"); !errors.Is(err, ErrTooManyRedirects) {
+		t.Errorf("3-hop chain with a limit of 2: error = %v, want ErrTooManyRedirects", err)
+	}
+
+	two := redirectChain(2)
+	defer two.Close()
+	page, err := f.Fetch(context.Background(), two.URL+"/0")
+	if err != nil {
+		t.Fatalf("2-hop chain with a limit of 2: %v", err)
+	}
+	if page.FinalURL != two.URL+"/2" {
+		t.Errorf("FinalURL = %q, want %s/2", page.FinalURL, two.URL)
+	}
+}
+
+func TestRedirectCheckRunsOnEveryHop(t *testing.T) {
+	chain := redirectChain(3)
+	defer chain.Close()
+	var hops []string
+	check := func(ctx context.Context, from, to string) string {
+		hops = append(hops, strings.TrimPrefix(from, chain.URL)+">"+strings.TrimPrefix(to, chain.URL))
+		if strings.HasSuffix(to, "/2") {
+			return "already seen"
+		}
+		return ""
+	}
+	ctx := WithRedirectCheck(context.Background(), check)
+	_, err := newTestFetcher(testConfig()).Fetch(ctx, chain.URL+"/0")
+	var redirectErr *RedirectError
+	if !errors.As(err, &redirectErr) || redirectErr.To != chain.URL+"/2" || redirectErr.Reason != "already seen" {
+		t.Fatalf("Fetch error = %v, want a *RedirectError for the hop to /2", err)
+	}
+	if got := strings.Join(hops, " "); got != "/0>/1 /1>/2" {
+		t.Errorf("checked hops %s, want /0>/1 /1>/2", got)
+	}
+	if HostFailure(err) {
+		t.Error("a rejected redirect counts as a host failure")
+	}
+}
+
+func TestCrossHostRedirectDropsHeaders(t *testing.T) {
+	var mu sync.Mutex
+	seen := make(map[string]http.Header)
+	record := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			seen[name] = r.Header.Clone()
+			mu.Unlock()
+			w.Header().Set("Content-Type", "text/html")
+		}
+	}
+	other := httptest.NewServer(record("other"))
+	defer other.Close()
+	// The same host under a name the credentials are not meant for.
+	otherURL := strings.Replace(other.URL, "127.0.0.1", "localhost", 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/away", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, otherURL+"/", http.StatusFound)
+	})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/here", http.StatusFound)
+	})
+	mux.HandleFunc("/here", record("same"))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	cfg := testConfig()
+	cfg.SeedUrls = []string{srv.URL + "/"}
+	cfg.Headers = map[string]string{"x-api-key": "k3y", "User-Agent": "custom/1.0"}
+	cfg.BearerToken = "t0ken"
+	f := newTestFetcher(cfg)
+	for _, path := range []string{"/away", "/moved"} {
+		if _, err := f.Fetch(context.Background(), srv.URL+path); err != nil {
+			t.Fatalf("Fetch %s: %v", path, err)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if h := seen["same"]; h.Get("X-Api-Key") != "k3y" || h.Get("Authorization") != "Bearer t0ken" {
+		t.Errorf("same-host hop lost the headers: %v", h)
+	}
+	h := seen["other"]
+	if h.Get("X-Api-Key") != "" || h.Get("Authorization") != "" {
+		t.Errorf("cross-host hop kept the configured headers or credentials: %v", h)
+	}
+	if h.Get("User-Agent") != "custom/1.0" {
+		t.Errorf("cross-host hop sent User-Agent %q", h.Get("User-Agent"))
+	}
+}
+
+func TestFetchSkipsUnwantedContentType(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Write([]byte("%PDF-1.7"))
+	}))
+	defer srv.Close()
+
+	page, err := newTestFetcher(testConfig()).Fetch(context.Background(), srv.URL)
+	var typeErr *ContentTypeError
+	if !errors.As(err, &typeErr) || typeErr.ContentType != "application/pdf" {
+		t.Errorf("Fetch error = %v, want a *ContentTypeError for application/pdf", err)
+	}
+	if len(page.Body) != 0 {
+		t.Errorf("body of %d bytes downloaded", len(page.Body))
+	}
+}
+
+func TestMaxBodyBytes(t *testing.T) {
+	body := strings.Repeat("x", 4096)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/chunked" {
+			// Flushing before writing leaves the length unknown up front.
+			w.(http.Flusher).Flush()
+		}
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	for _, path := range []string{"/sized", "/chunked"} {
+		cfg := testConfig()
+		cfg.MaxBodyBytes = 1024
+		page, err := newTestFetcher(cfg).Fetch(context.Background(), srv.URL+path)
+		if !errors.Is(err, ErrBodyTooLarge) {
+			t.Errorf("%s: error = %v, want ErrBodyTooLarge", path, err)
+		}
+		if len(page.Body) != 0 {
+			t.Errorf("%s: returned %d bytes of an oversized body", path, len(page.Body))
+		}
+
+		cfg.TruncateBodies = true
+		page, err = newTestFetcher(cfg).Fetch(context.Background(), srv.URL+path)
+		if err != nil {
+			t.Fatalf("%s with truncation: %v", path, err)
+		}
+		if len(page.Body) != 1024 {
+			t.Errorf("%s: truncated body is %d bytes, want 1024", path, len(page.Body))
+		}
+	}
+}
+
+func TestCustomHeaders(t *testing.T) {
+	// The server echoes the request headers back as the body.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		r.Header.Write(w)
+	}))
+	defer srv.Close()
+
+	cfg := testConfig()
+	cfg.Headers = map[string]string{"Accept-Language": "de", "X-Crawl-Id": "42", "User-Agent": "custom/1.0"}
+	cfg.ContentTypes = nil
+	page, err := newTestFetcher(cfg).Fetch(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sent, err := textproto.NewReader(bufio.NewReader(bytes.NewReader(append(page.Body, "\r\n"...)))).ReadMIMEHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range cfg.Headers {
+		if got := sent.Get(name); got != want {
+			t.Errorf("%s header = %q, want %q", name, got, want)
+		}
+	}
+}
+
+// sessionServer sets a session cookie on /login and answers /private with
+// 403 Forbidden unless the request carries it.
+func sessionServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/login":
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "s3cret", Path: "/"})
+		case "/private":
+			if c, err := r.Cookie("session"); err != nil || c.Value != "s3cret" {
+				http.Error(w, "log in first", http.StatusForbidden)
+				return
+			}
+			w.Write([]byte("<title>private</title>"))
+		}
+	}))
+}
+
+func TestCookiesKeptBetweenRequests(t *testing.T) {
+	srv := sessionServer()
+	defer srv.Close()
+	fetch := func(cfg *common.ConfigManager) error {
+		f := newTestFetcher(cfg)
+		if _, err := f.Fetch(context.Background(), srv.URL+"/login"); err != nil {
+			return err
+		}
+		_, err := f.Fetch(context.Background(), srv.URL+"/private")
+		return err
+	}
+
+	var statusErr *StatusError
+	if err := fetch(testConfig()); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusForbidden {
+		t.Errorf("without cookies: error = %v, want 403", err)
+	}
+	cfg := testConfig()
+	cfg.EnableCookies = true
+	if err := fetch(cfg); err != nil {
+		t.Errorf("with cookies: %v", err)
+	}
+}
+
+func TestCookieFile(t *testing.T) {
+	srv := sessionServer()
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	path := filepath.Join(t.TempDir(), "cookies.txt")
+	file := "# Netscape HTTP Cookie File\n" + u.Hostname() + "\tFALSE\t/\tFALSE\t0\tsession\ts3cret\n"
+	if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := testConfig()
+	cfg.CookieFile = path
+	cfg.EnableCookies = true
+	if _, err := newTestFetcher(cfg).Fetch(context.Background(), srv.URL+"/private"); err != nil {
+		t.Errorf("with the session cookie from a file: %v", err)
+	}
+}
+
+func TestCookieFileLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cookies.txt")
+	file := "# Netscape HTTP Cookie File\r\n" +
+		"\r\n" +
+		"example.com\tFALSE\t/\tFALSE\t0\tsession\ts3cret\r\n" +
+		"example.com\tFALSE\t/\tFALSE\t0\tconsent\t\r\n" +
+		"#HttpOnly_example.com\tFALSE\t/\tFALSE\t0\ttoken\tabc\n"
+	if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	jar, err := newCookieJar(path)
+	if err != nil {
+		t.Fatalf("newCookieJar: %v", err)
+	}
+	u, _ := url.Parse("http://example.com/")
+	got := make(map[string]string)
+	for _, c := range jar.Cookies(u) {
+		got[c.Name] = c.Value
+	}
+	want := map[string]string{"session": "s3cret", "consent": "", "token": "abc"}
+	if len(got) != len(want) {
+		t.Errorf("cookies = %v, want %v", got, want)
+	}
+	for name, value := range want {
+		if v, ok := got[name]; !ok || v != value {
+			t.Errorf("cookie %s = %q, %v; want %q", name, v, ok, value)
+		}
+	}
+}
+
+func TestLatencyExcludesRetries(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			http.Error(w, "try again", http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<title>ok</title>"))
+	}))
+	defer srv.Close()
+
+	cfg := testConfig()
+	cfg.BaseBackoff = 200 * time.Millisecond
+	start := time.Now()
+	page, err := newTestFetcher(cfg).Fetch(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Latency <= 0 || page.Latency >= time.Since(start)/2 {
+		t.Errorf("Latency = %v of a %v fetch that waited out a retry backoff", page.Latency, time.Since(start))
+	}
+}
+
+// authServer answers 401 Unauthorized unless the request carries want as
+// its Authorization header.
+func authServer(want string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != want {
+			w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<title>members</title>"))
+	}))
+}
+
+func TestAuthentication(t *testing.T) {
+	basic := "Basic " + base64.StdEncoding.EncodeToString([]byte("alice:s3cret"))
+	tests := []struct {
+		name      string
+		configure func(cfg *common.ConfigManager)
+		want      int
+	}{
+		{"no credentials", func(cfg *common.ConfigManager) {}, http.StatusUnauthorized},
+		{"wrong password", func(cfg *common.ConfigManager) {
+			cfg.BasicAuthUser, cfg.BasicAuthPass = "alice", "guess"
+		}, http.StatusUnauthorized},
+		{"basic", func(cfg *common.ConfigManager) {
+			cfg.BasicAuthUser, cfg.BasicAuthPass = "alice", "s3cret"
+		}, http.StatusOK},
+		{"other host", func(cfg *common.ConfigManager) {
+			cfg.BasicAuthUser, cfg.BasicAuthPass = "alice", "s3cret"
+			cfg.AuthHosts = []string{"*.example.com"}
+		}, http.StatusUnauthorized},
+	}
+	srv := authServer(basic)
+	defer srv.Close()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			cfg := testConfig()
+			cfg.SeedUrls = []string{srv.URL + "/"}
+			cfg.Logger = slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+			tt.configure(cfg)
+			page, _ := newTestFetcher(cfg).Fetch(context.Background(), srv.URL+"/members")
+			if page.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", page.StatusCode, tt.want)
+			}
+			if strings.Contains(logs.String(), "s3cret") {
+				t.Errorf("password logged:\n%s", logs.String())
+			}
+		})
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	srv := authServer("Bearer t0ken")
+	defer srv.Close()
+	cfg := testConfig()
+	cfg.SeedUrls = []string{srv.URL + "/"}
+	cfg.BearerToken = "t0ken"
+	if _, err := newTestFetcher(cfg).Fetch(context.Background(), srv.URL+"/members"); err != nil {
+		t.Errorf("with a bearer token: %v", err)
+	}
+}
@@ -0,0 +1,184 @@
+package fetcher
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/chromedp"
+
+	"crawler/common"
+)
+
+// Rendered pages are considered settled once the DOM has gone settleQuiet
+// without a mutation, or after settleMax at the latest.
+const (
+	settleQuiet = 500 * time.Millisecond
+	settleMax   = 5 * time.Second
+)
+
+// settleScript resolves once the document has stopped changing.
+var settleScript = fmt.Sprintf(`new Promise(resolve => {
+	let quiet;
+	const done = () => { observer.disconnect(); clearTimeout(quiet); clearTimeout(limit); resolve(true); };
+	const observer = new MutationObserver(() => { clearTimeout(quiet); quiet = setTimeout(done, %[1]d); });
+	observer.observe(document, {subtree: true, childList: true, attributes: true, characterData: true});
+	quiet = setTimeout(done, %[1]d);
+	const limit = setTimeout(done, %[2]d);
+})`, settleQuiet.Milliseconds(), settleMax.Milliseconds())
+
+// loadError reports a page the browser could not load, such as one whose
+// host does not resolve.
+type loadError struct {
+	url string
+	err error
+}
+
+func (e *loadError) Error() string {
+	return fmt.Sprintf("rendering %s: %v", e.url, e.err)
+}
+
+func (e *loadError) Unwrap() error { return e.err }
+
+// HeadlessFetcher loads pages in headless Chrome and returns the HTML left
+// once their scripts have settled, for sites that build their content
+// client-side. It sends the configured User-Agent, headers and proxy, but
+// not credentials or cookies, and does not retry. Each fetch runs in its own
+// tab of a shared browser, limited by the HTTP timeout.
+type HeadlessFetcher struct {
+	browser       context.Context
+	cancelBrowser context.CancelFunc
+	cancelAlloc   context.CancelFunc
+	headers       network.Headers
+	timeout       time.Duration
+	types         []string
+	maxBody       int64
+	truncate      bool
+	log           *slog.Logger
+}
+
+// NewHeadlessFetcher starts headless Chrome, found on the PATH or in its
+// usual install locations, and returns an error if it cannot be run.
+func NewHeadlessFetcher(cfg *common.ConfigManager) (*HeadlessFetcher, error) {
+	opts := append(chromedp.DefaultExecAllocatorOptions[:], chromedp.UserAgent(cfg.UserAgent))
+	if cfg.ProxyURL != "" {
+		opts = append(opts, chromedp.ProxyServer(cfg.ProxyURL))
+	}
+	allocCtx, cancelAlloc := chromedp.NewExecAllocator(context.Background(), opts...)
+	browser, cancelBrowser := chromedp.NewContext(allocCtx)
+	if err := chromedp.Run(browser); err != nil {
+		cancelBrowser()
+		cancelAlloc()
+		return nil, fmt.Errorf("starting headless browser: %w", err)
+	}
+	headers := make(network.Headers, len(cfg.Headers))
+	for name, value := range cfg.Headers {
+		if name != "User-Agent" {
+			headers[name] = value
+		}
+	}
+	return &HeadlessFetcher{
+		browser:       browser,
+		cancelBrowser: cancelBrowser,
+		cancelAlloc:   cancelAlloc,
+		headers:       headers,
+		timeout:       cfg.HTTPTimeout,
+		types:         cfg.ContentTypes,
+		maxBody:       cfg.MaxBodyBytes,
+		truncate:      cfg.TruncateBodies,
+		log:           cfg.Log(),
+	}, nil
+}
+
+// Fetch loads url, waits for its DOM to settle and returns the rendered
+// HTML. Cancelling ctx closes the tab.
+func (f *HeadlessFetcher) Fetch(ctx context.Context, url string) (common.FetchedPageData, error) {
+	page := common.FetchedPageData{URL: url}
+	tab, closeTab := chromedp.NewContext(f.browser)
+	defer closeTab()
+	stop := context.AfterFunc(ctx, closeTab)
+	defer stop()
+	if f.timeout > 0 {
+		var cancel context.CancelFunc
+		tab, cancel = context.WithTimeout(tab, f.timeout)
+		defer cancel()
+	}
+
+	var actions []chromedp.Action
+	if len(f.headers) > 0 {
+		actions = append(actions, network.SetExtraHTTPHeaders(f.headers))
+	}
+	start := time.Now()
+	resp, err := chromedp.RunResponse(tab, append(actions, chromedp.Navigate(url))...)
+	if err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return page, &loadError{url: url, err: err}
+	}
+	page.StatusCode = int(resp.Status)
+	page.Latency = time.Since(start)
+	page.ETag = header(resp.Headers, "ETag")
+	page.LastModified = header(resp.Headers, "Last-Modified")
+	page.Language = header(resp.Headers, "Content-Language")
+	if page.StatusCode < 200 || page.StatusCode > 299 {
+		status := resp.StatusText
+		if status == "" {
+			status = http.StatusText(page.StatusCode)
+		}
+		return page, &StatusError{URL: url, StatusCode: page.StatusCode, Status: fmt.Sprintf("%d %s", page.StatusCode, status)}
+	}
+	if contentType := header(resp.Headers, "Content-Type"); !allowsType(f.types, contentType) {
+		return page, &ContentTypeError{URL: url, ContentType: contentType}
+	}
+
+	var finalURL, html string
+	awaitPromise := func(p *runtime.EvaluateParams) *runtime.EvaluateParams { return p.WithAwaitPromise(true) }
+	if err := chromedp.Run(tab,
+		chromedp.Evaluate(settleScript, nil, awaitPromise),
+		chromedp.Location(&finalURL),
+		chromedp.OuterHTML("html", &html, chromedp.ByQuery),
+	); err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return page, &loadError{url: url, err: err}
+	}
+	if finalURL != url {
+		page.FinalURL = finalURL
+	}
+	page.Body = []byte(html)
+	if f.maxBody > 0 && int64(len(page.Body)) > f.maxBody {
+		if !f.truncate {
+			page.Body = nil
+			return page, fmt.Errorf("reading body of %s: %w (limit %d bytes)", url, ErrBodyTooLarge, f.maxBody)
+		}
+		page.Body = page.Body[:f.maxBody]
+	}
+	f.log.Debug("page rendered", "url", url, "status", page.StatusCode, "bytes", len(page.Body))
+	return page, nil
+}
+
+// Close shuts the browser down.
+func (f *HeadlessFetcher) Close() error {
+	f.cancelBrowser()
+	f.cancelAlloc()
+	return nil
+}
+
+// header returns the value of the named response header, whose names the
+// browser may report in any case.
+func header(headers network.Headers, name string) string {
+	for k, v := range headers {
+		if strings.EqualFold(k, name) {
+			s, _ := v.(string)
+			return s
+		}
+	}
+	return ""
+}
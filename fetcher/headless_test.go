@@ -0,0 +1,20 @@
+package fetcher
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHeadlessFetcherWithoutBrowser(t *testing.T) {
+	// An empty PATH hides any browser but those in the usual install
+	// locations.
+	t.Setenv("PATH", t.TempDir())
+	browser, err := NewHeadlessFetcher(testConfig())
+	if err == nil {
+		browser.Close()
+		t.Skip("headless Chrome is installed")
+	}
+	if !strings.Contains(err.Error(), "starting headless browser") {
+		t.Errorf("NewHeadlessFetcher error = %v, want one naming the browser", err)
+	}
+}
@@ -0,0 +1,76 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"crawler/common"
+	"crawler/fetcher"
+)
+
+// fakeFetcher serves pages from memory and fails for any other URL.
+type fakeFetcher struct {
+	mu      sync.Mutex
+	pages   map[string]string
+	fetched []string
+}
+
+func (f *fakeFetcher) Fetch(ctx context.Context, url string) (common.FetchedPageData, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fetched = append(f.fetched, url)
+	body, ok := f.pages[url]
+	if !ok {
+		return common.FetchedPageData{URL: url}, errors.New("render failed")
+	}
+	return common.FetchedPageData{URL: url, FinalURL: url, StatusCode: 200, Body: []byte(body)}, nil
+}
+
+func TestUseFetcher(t *testing.T) {
+	// The site only answers robots.txt; pages come from the fake fetcher.
+	s := newSite(t, nil)
+	fake := &fakeFetcher{pages: map[string]string{
+		s.URL + "/":  `<title>rendered</title><a href="/a">a</a> <a href="/broken">broken</a>`,
+		s.URL + "/a": `<title>a</title>`,
+	}}
+	c, store := newTestCrawler(t, testConfig(s.URL+"/"))
+	c.UseFetcher(fake)
+	run(t, c)
+
+	if len(fake.fetched) != 3 {
+		t.Errorf("fake fetcher called for %v, want the seed and its two links", fake.fetched)
+	}
+	if n := s.hitCount("/") + s.hitCount("/a"); n != 0 {
+		t.Errorf("pages fetched over HTTP %d times", n)
+	}
+	if page, _ := store.Get(s.URL + "/"); page.Title != "rendered" {
+		t.Errorf("stored title %q, want the fake fetcher's", page.Title)
+	}
+	if n := len(store.Pages()); n != 2 {
+		t.Errorf("stored %d pages, want 2", n)
+	}
+	if n := c.Stats().Errors; n != 1 {
+		t.Errorf("Errors = %d, want 1 for the failed fetch", n)
+	}
+}
+
+func TestHeadlessFetcherFallsBackToHTTP(t *testing.T) {
+	cfg := testConfig()
+	if browser, err := fetcher.NewHeadlessFetcher(cfg); err == nil {
+		browser.Close()
+		t.Skip("headless Chrome is installed")
+	}
+	s := newSite(t, map[string]string{"/": `<title>home</title>`})
+	cfg.SeedUrls = []string{s.URL + "/"}
+	cfg.Fetcher = fetcher.FetcherHeadless
+	c, store := newTestCrawler(t, cfg)
+	if _, ok := c.fetcher.(*fetcher.HTTPFetcher); !ok || c.browser != nil {
+		t.Fatalf("fetcher is %T without a browser, want the HTTP fetcher", c.fetcher)
+	}
+	run(t, c)
+	if _, ok := store.Get(s.URL + "/"); !ok {
+		t.Error("page not stored by the fallback fetcher")
+	}
+}
@@ -0,0 +1,73 @@
+package crawler
+
+import "crawler/common"
+
+// hooks are the callbacks registered with the On* methods, run in
+// registration order.
+type hooks struct {
+	discover    []func(jobID, pageURL string, depth int)
+	beforeFetch []func(pageURL string) error
+	afterFetch  []func(page *common.FetchedPageData)
+	beforeStore []func(data *common.PageStorageData) error
+}
+
+// OnDiscover registers fn to run on every URL enqueued for crawling, seeds
+// and sitemap entries included, with the ID of the job it belongs to and
+// its depth. URLs dropped by the filters, robots.txt or as already seen are
+// not reported. Hooks must be registered before Start and may be called
+// from several workers at once.
+func (c *Crawler) OnDiscover(fn func(jobID, pageURL string, depth int)) {
+	c.hooks.discover = append(c.hooks.discover, fn)
+}
+
+// OnBeforeFetch registers fn to run before every page is fetched. If fn
+// returns an error the URL is skipped. Hooks must be registered before
+// Start and may be called from several workers at once.
+func (c *Crawler) OnBeforeFetch(fn func(pageURL string) error) {
+	c.hooks.beforeFetch = append(c.hooks.beforeFetch, fn)
+}
+
+// OnAfterFetch registers fn to run on every fetch result, failed ones
+// included, before it is looked at. fn may modify the page. Hooks must be
+// registered before Start and may be called from several workers at once.
+func (c *Crawler) OnAfterFetch(fn func(page *common.FetchedPageData)) {
+	c.hooks.afterFetch = append(c.hooks.afterFetch, fn)
+}
+
+// OnBeforeStore registers fn to run on every parsed page before it is
+// stored and sent to Results. fn may modify the page; if it returns an error
+// the page is dropped. Hooks must be registered before Start and may be
+// called from several workers at once.
+func (c *Crawler) OnBeforeStore(fn func(data *common.PageStorageData) error) {
+	c.hooks.beforeStore = append(c.hooks.beforeStore, fn)
+}
+
+func (h *hooks) runDiscover(jobID, pageURL string, depth int) {
+	for _, fn := range h.discover {
+		fn(jobID, pageURL, depth)
+	}
+}
+
+func (h *hooks) runBeforeFetch(pageURL string) error {
+	for _, fn := range h.beforeFetch {
+		if err := fn(pageURL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *hooks) runAfterFetch(page *common.FetchedPageData) {
+	for _, fn := range h.afterFetch {
+		fn(page)
+	}
+}
+
+func (h *hooks) runBeforeStore(data *common.PageStorageData) error {
+	for _, fn := range h.beforeStore {
+		if err := fn(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package crawler
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"crawler/common"
+)
+
+func TestBeforeStoreHookChangesStoredPage(t *testing.T) {
+	s := newSite(t, map[string]string{
+		"/":  `<title>home</title><a href="/a">a</a>`,
+		"/a": `<title>a</title>`,
+	})
+	c, store := newTestCrawler(t, testConfig(s.URL+"/"))
+	c.OnBeforeStore(func(data *common.PageStorageData) error {
+		data.Title = strings.ToUpper(data.Title)
+		return nil
+	})
+	// Hooks run in registration order, so this one sees the first's change.
+	c.OnBeforeStore(func(data *common.PageStorageData) error {
+		if data.Title == "A" {
+			return errors.New("not wanted")
+		}
+		return nil
+	})
+	run(t, c)
+
+	if page, _ := store.Get(s.URL + "/"); page.Title != "HOME" {
+		t.Errorf("stored title %q, want the hook's HOME", page.Title)
+	}
+	if _, ok := store.Get(s.URL + "/a"); ok {
+		t.Error("page rejected by a hook stored")
+	}
+}
+
+func TestBeforeFetchHookErrorSkipsURL(t *testing.T) {
+	s := newSite(t, map[string]string{
+		"/":        `<a href="/a">a</a> <a href="/private">private</a>`,
+		"/a":       `<title>a</title>`,
+		"/private": `<a href="/secret">secret</a>`,
+		"/secret":  `<title>secret</title>`,
+	})
+	c, store := newTestCrawler(t, testConfig(s.URL+"/"))
+	c.OnBeforeFetch(func(pageURL string) error {
+		if strings.HasSuffix(pageURL, "/private") {
+			return errors.New("private")
+		}
+		return nil
+	})
+	var mu sync.Mutex
+	var fetched []string
+	c.OnAfterFetch(func(page *common.FetchedPageData) {
+		mu.Lock()
+		defer mu.Unlock()
+		fetched = append(fetched, page.URL)
+	})
+	run(t, c)
+
+	if n := s.hitCount("/private"); n != 0 {
+		t.Errorf("URL skipped by a hook fetched %d times", n)
+	}
+	if n := len(store.Pages()); n != 2 {
+		t.Errorf("stored %d pages, want the seed and /a", n)
+	}
+	if len(fetched) != 2 {
+		t.Errorf("after-fetch hook saw %v, want the seed and /a", fetched)
+	}
+}
+
+func TestDiscoverHookReportsEnqueuedURLs(t *testing.T) {
+	s := newSite(t, map[string]string{
+		"/":  `<a href="/a">a</a> <a href="/a#top">again</a> <a href="/missing">gone</a> <a href="/drafts/x">draft</a>`,
+		"/a": `<a href="/b">b</a>`,
+	})
+	cfg := testConfig(s.URL + "/")
+	cfg.DryRun = true
+	cfg.ExcludePatterns = []string{`/drafts/`}
+	c, store := newTestCrawler(t, cfg)
+	var mu sync.Mutex
+	discovered := make(map[string]int)
+	c.OnDiscover(func(jobID, pageURL string, depth int) {
+		mu.Lock()
+		defer mu.Unlock()
+		if jobID != "" {
+			t.Errorf("job ID %q in a single-job crawl", jobID)
+		}
+		discovered[strings.TrimPrefix(pageURL, s.URL)] = depth
+	})
+	run(t, c)
+
+	want := map[string]int{"/": 0, "/a": 1, "/missing": 1, "/b": 2}
+	if len(discovered) != len(want) {
+		t.Errorf("discovered %v, want %v", discovered, want)
+	}
+	for path, depth := range want {
+		if got, ok := discovered[path]; !ok || got != depth {
+			t.Errorf("%s discovered at depth %d, %v; want depth %d", path, got, ok, depth)
+		}
+	}
+	if n := len(store.Pages()); n != 0 {
+		t.Errorf("dry run stored %d pages", n)
+	}
+}
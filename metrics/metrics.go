@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var registry = prometheus.NewRegistry()
+
+var (
+	PagesFetched = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "crawler_pages_fetched_total",
+		Help: "Pages downloaded successfully.",
+	})
+	PagesNotModified = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "crawler_pages_not_modified_total",
+		Help: "Conditional requests answered with 304 Not Modified.",
+	})
+	FetchErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "crawler_fetch_errors_total",
+		Help: "Fetches that failed after all retries.",
+	})
+	PagesStored = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "crawler_pages_stored_total",
+		Help: "Pages written to storage.",
+	})
+	URLsDiscovered = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "crawler_urls_discovered_total",
+		Help: "URLs added to the frontier.",
+	})
+	QueueLength = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "crawler_queue_length",
+		Help: "URLs waiting to be fetched, over all jobs.",
+	})
+	VisitedSize = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "crawler_visited_urls",
+		Help: "URLs seen so far, queued or fetched, over all jobs.",
+	})
+	InFlightWorkers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "crawler_in_flight_workers",
+		Help: "Workers currently processing a URL, over all jobs.",
+	})
+)
+
+func init() {
+	registry.MustRegister(PagesFetched, PagesNotModified, FetchErrors, PagesStored, URLsDiscovered, QueueLength, VisitedSize, InFlightWorkers)
+}
+
+// Server exposes the crawler metrics on /metrics.
+type Server struct {
+	srv *http.Server
+}
+
+// StartServer serves /metrics on port in the background, logging serve
+// errors to logger. A port of zero disables the server and returns nil; a
+// nil *Server is safe to Shutdown.
+func StartServer(port int, logger *slog.Logger) *Server {
+	if port == 0 {
+		return nil
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	s := &Server{srv: &http.Server{Addr: fmt.Sprintf(":%d", port), Handler: mux}}
+	go func() {
+		if err := s.srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("metrics server failed", "error", err)
+		}
+	}()
+	return s
+}
+
+// Shutdown stops the server, waiting for in-progress scrapes until ctx is
+// done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	if s == nil {
+		return nil
+	}
+	return s.srv.Shutdown(ctx)
+}
@@ -0,0 +1,15 @@
+package parser
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// ContentHash returns the hex SHA-256 of body with runs of whitespace
+// collapsed, so pages differing only in formatting hash alike.
+func ContentHash(body []byte) string {
+	normalized := strings.Join(strings.Fields(string(body)), " ")
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,54 @@
+package parser
+
+import "strings"
+
+// NormalizeLanguage returns tag as a BCP-47 language tag in its canonical
+// case, e.g. "en_us" becomes "en-US" and "zh-hant-tw" becomes "zh-Hant-TW".
+// Only the first tag of a comma-separated Content-Language list is kept.
+// Anything that is not a well-formed tag yields "".
+func NormalizeLanguage(tag string) string {
+	tag, _, _ = strings.Cut(tag, ",")
+	tag = strings.ReplaceAll(strings.TrimSpace(tag), "_", "-")
+	if tag == "" {
+		return ""
+	}
+	subtags := strings.Split(strings.ToLower(tag), "-")
+	if !isAlpha(subtags[0]) || len(subtags[0]) < 2 || len(subtags[0]) > 8 {
+		return ""
+	}
+	for i := 1; i < len(subtags); i++ {
+		s := subtags[i]
+		if s == "" || len(s) > 8 || !isAlphanumeric(s) {
+			return ""
+		}
+		switch {
+		// A single-letter subtag starts an extension or private use section,
+		// which keeps its lower case.
+		case len(s) == 1:
+			return strings.Join(subtags, "-")
+		case len(s) == 4 && isAlpha(s):
+			subtags[i] = strings.ToUpper(s[:1]) + s[1:]
+		case len(s) == 2 && isAlpha(s):
+			subtags[i] = strings.ToUpper(s)
+		}
+	}
+	return strings.Join(subtags, "-")
+}
+
+func isAlpha(s string) bool {
+	for _, r := range s {
+		if r < 'a' || r > 'z' {
+			return false
+		}
+	}
+	return true
+}
+
+func isAlphanumeric(s string) bool {
+	for _, r := range s {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,42 @@
+package parser
+
+import "testing"
+
+func TestNormalizeLanguage(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"en", "en"},
+		{"EN-us", "en-US"},
+		{"en_GB", "en-GB"},
+		{"zh-hant-tw", "zh-Hant-TW"},
+		{" de-CH ", "de-CH"},
+		{"fr-CA, en", "fr-CA"},
+		{"en-x-private", "en-x-private"},
+		{"", ""},
+		{"e", ""},
+		{"en--us", ""},
+		{"12", ""},
+		{"not a tag", ""},
+	}
+	for _, tt := range tests {
+		if got := NormalizeLanguage(tt.in); got != tt.want {
+			t.Errorf("NormalizeLanguage(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParsePageLanguage(t *testing.T) {
+	tests := []struct{ name, body, want string }{
+		{"lang attribute", `<html lang="pt_br"><title>x</title></html>`, "pt-BR"},
+		{"no lang attribute", `<html><title>x</title></html>`, ""},
+		{"malformed lang attribute", `<html lang="??"><title>x</title></html>`, ""},
+	}
+	for _, tt := range tests {
+		data, _, err := ParsePage([]byte(tt.body), "http://example.com/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data.Language != tt.want {
+			t.Errorf("%s: Language = %q, want %q", tt.name, data.Language, tt.want)
+		}
+	}
+}
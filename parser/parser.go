@@ -0,0 +1,128 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+
+	"crawler/common"
+)
+
+// ParsePage extracts the title, meta description, canonical URL and
+// <html lang> language of an HTML page, along with the absolute http(s)
+// links it contains. Links are resolved against baseURL, or the page's first
+// <base href> if it has one, deduplicated and stripped of fragments; links
+// that only point at a fragment of the same page are skipped.
+func ParsePage(body []byte, baseURL string) (common.PageStorageData, []string, error) {
+	data := common.PageStorageData{URL: baseURL}
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return data, nil, fmt.Errorf("parsing base URL %q: %w", baseURL, err)
+	}
+	doc, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return data, nil, fmt.Errorf("parsing HTML of %s: %w", baseURL, err)
+	}
+
+	var links []string
+	seen := make(map[string]bool)
+	baseSet := false
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.Data {
+			case "html":
+				if data.Language == "" {
+					data.Language = NormalizeLanguage(attr(n, "lang"))
+				}
+			case "base":
+				if href := strings.TrimSpace(attr(n, "href")); href != "" && !baseSet {
+					baseSet = true
+					if ref, err := url.Parse(href); err == nil {
+						base = base.ResolveReference(ref)
+					}
+				}
+			case "title":
+				if data.Title == "" {
+					data.Title = strings.TrimSpace(textContent(n))
+				}
+			case "meta":
+				if strings.EqualFold(attr(n, "name"), "description") && data.Description == "" {
+					data.Description = strings.TrimSpace(attr(n, "content"))
+				}
+			case "link":
+				if hasToken(attr(n, "rel"), "canonical") && data.CanonicalURL == "" {
+					if canonical, ok := resolve(base, attr(n, "href")); ok {
+						data.CanonicalURL = canonical
+					}
+				}
+			case "a":
+				if link, ok := resolve(base, attr(n, "href")); ok && !seen[link] {
+					seen[link] = true
+					links = append(links, link)
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	data.LinkCount = len(links)
+	return data, links, nil
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func hasToken(list, token string) bool {
+	for _, f := range strings.Fields(list) {
+		if strings.EqualFold(f, token) {
+			return true
+		}
+	}
+	return false
+}
+
+func textContent(n *html.Node) string {
+	var sb strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			sb.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return sb.String()
+}
+
+func resolve(base *url.URL, href string) (string, bool) {
+	href = strings.TrimSpace(href)
+	if href == "" || strings.HasPrefix(href, "#") {
+		return "", false
+	}
+	ref, err := url.Parse(href)
+	if err != nil {
+		return "", false
+	}
+	abs := base.ResolveReference(ref)
+	if abs.Scheme != "http" && abs.Scheme != "https" {
+		return "", false
+	}
+	abs.Fragment = ""
+	abs.RawFragment = ""
+	return abs.String(), true
+}
@@ -0,0 +1,133 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParsePageLinks(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{
+			name: "relative links",
+			body: `<a href="/a">a</a><a href="b">b</a><a href="../c">c</a><a href="?q=1">q</a>`,
+			want: []string{"http://example.com/a", "http://example.com/dir/b", "http://example.com/c", "http://example.com/dir/page?q=1"},
+		},
+		{
+			name: "absolute links",
+			body: `<a href="https://other.example/x">x</a><a href="//cdn.example/y">y</a>`,
+			want: []string{"https://other.example/x", "http://cdn.example/y"},
+		},
+		{
+			name: "fragments stripped and fragment-only links skipped",
+			body: `<a href="#top">top</a><a href="/a#part">a</a><a href="/a#other">again</a><a href=" #x ">x</a>`,
+			want: []string{"http://example.com/a"},
+		},
+		{
+			name: "duplicates dropped",
+			body: `<a href="/a">1</a><a href="/a">2</a><a href="http://example.com/a">3</a>`,
+			want: []string{"http://example.com/a"},
+		},
+		{
+			name: "malformed and non-http links skipped",
+			body: `<a href="http://[::1">bad</a><a href="mailto:a@example.com">m</a><a href="javascript:void(0)">js</a><a>none</a><a href="  ">blank</a><a href="/ok">ok</a>`,
+			want: []string{"http://example.com/ok"},
+		},
+		{
+			name: "nested in other elements",
+			body: `<div><p><span><a href="/deep"><b>deep</b></a></span></p></div>`,
+			want: []string{"http://example.com/deep"},
+		},
+		{
+			name: "base href",
+			body: `<head><base href="/other/"></head><a href="x">x</a><a href="/abs">abs</a>`,
+			want: []string{"http://example.com/other/x", "http://example.com/abs"},
+		},
+		{
+			name: "absolute base href",
+			body: `<head><base href="https://mirror.example/root/"></head><a href="x">x</a>`,
+			want: []string{"https://mirror.example/root/x"},
+		},
+		{
+			name: "only the first base href counts",
+			body: `<head><base href="/first/"><base href="/second/"></head><a href="x">x</a>`,
+			want: []string{"http://example.com/first/x"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, links, err := ParsePage([]byte(tt.body), "http://example.com/dir/page")
+			if err != nil {
+				t.Fatalf("ParsePage: %v", err)
+			}
+			if got, want := strings.Join(links, " "), strings.Join(tt.want, " "); got != want {
+				t.Errorf("links = %s, want %s", got, want)
+			}
+			if data.LinkCount != len(tt.want) {
+				t.Errorf("LinkCount = %d, want %d", data.LinkCount, len(tt.want))
+			}
+		})
+	}
+}
+
+func TestParsePageMetadata(t *testing.T) {
+	tests := []struct {
+		name                             string
+		body                             string
+		title, description, canonicalURL string
+	}{
+		{
+			name:  "title text is trimmed and unescaped",
+			body:  "<title>\n  Fish &amp; chips \n</title>",
+			title: "Fish & chips",
+		},
+		{
+			name:  "first title wins",
+			body:  `<title>First</title><svg><title>Icon</title></svg>`,
+			title: "First",
+		},
+		{
+			name:        "meta description",
+			body:        `<meta name="Description" content=" About fish "><meta name="description" content="later">`,
+			description: "About fish",
+		},
+		{
+			name:         "canonical resolved",
+			body:         `<link rel="alternate canonical" href="/canon?x=1#frag">`,
+			canonicalURL: "http://example.com/canon?x=1",
+		},
+		{
+			name:         "canonical resolved against base href",
+			body:         `<base href="https://mirror.example/"><link rel="canonical" href="page">`,
+			canonicalURL: "https://mirror.example/page",
+		},
+		{
+			name: "nothing declared",
+			body: `<p>just text</p>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, _, err := ParsePage([]byte(tt.body), "http://example.com/dir/page")
+			if err != nil {
+				t.Fatalf("ParsePage: %v", err)
+			}
+			if data.URL != "http://example.com/dir/page" {
+				t.Errorf("URL = %q", data.URL)
+			}
+			if data.Title != tt.title || data.Description != tt.description || data.CanonicalURL != tt.canonicalURL {
+				t.Errorf("title, description, canonical = %q, %q, %q; want %q, %q, %q",
+					data.Title, data.Description, data.CanonicalURL, tt.title, tt.description, tt.canonicalURL)
+			}
+		})
+	}
+}
+
+func TestParsePageInvalidBaseURL(t *testing.T) {
+	if _, _, err := ParsePage([]byte(`<a href="/a">a</a>`), "http://[::1"); err == nil {
+		t.Error("ParsePage accepted an unparseable base URL")
+	}
+}
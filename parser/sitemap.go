@@ -0,0 +1,74 @@
+package parser
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// maxSitemapBytes is the uncompressed size limit from the sitemaps.org
+// protocol; it also guards against gzip bombs.
+const maxSitemapBytes = 50 << 20
+
+type sitemapDoc struct {
+	XMLName  xml.Name
+	URLs     []sitemapLoc `xml:"url"`
+	Sitemaps []sitemapLoc `xml:"sitemap"`
+}
+
+type sitemapLoc struct {
+	Loc string `xml:"loc"`
+}
+
+// ParseSitemap returns the <loc> entries of a sitemap URL set or sitemap
+// index. Gzipped bodies are decompressed transparently.
+func ParseSitemap(body []byte) ([]string, error) {
+	locs, _, err := ParseSitemapIndex(body)
+	return locs, err
+}
+
+// ParseSitemapIndex is like ParseSitemap but also reports whether body was a
+// sitemap index, in which case the locations are further sitemaps.
+func ParseSitemapIndex(body []byte) ([]string, bool, error) {
+	if len(body) >= 2 && body[0] == 0x1f && body[1] == 0x8b {
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, false, fmt.Errorf("decompressing sitemap: %w", err)
+		}
+		defer zr.Close()
+		body, err = io.ReadAll(io.LimitReader(zr, maxSitemapBytes+1))
+		if err != nil {
+			return nil, false, fmt.Errorf("decompressing sitemap: %w", err)
+		}
+	}
+	if len(body) > maxSitemapBytes {
+		return nil, false, fmt.Errorf("sitemap exceeds %d bytes", maxSitemapBytes)
+	}
+
+	var doc sitemapDoc
+	if err := xml.Unmarshal(body, &doc); err != nil {
+		return nil, false, fmt.Errorf("parsing sitemap: %w", err)
+	}
+
+	var entries []sitemapLoc
+	isIndex := false
+	switch doc.XMLName.Local {
+	case "urlset":
+		entries = doc.URLs
+	case "sitemapindex":
+		entries, isIndex = doc.Sitemaps, true
+	default:
+		return nil, false, fmt.Errorf("parsing sitemap: unexpected root element <%s>", doc.XMLName.Local)
+	}
+
+	locs := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if loc := strings.TrimSpace(entry.Loc); loc != "" {
+			locs = append(locs, loc)
+		}
+	}
+	return locs, isIndex, nil
+}
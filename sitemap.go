@@ -0,0 +1,64 @@
+package crawler
+
+import (
+	"context"
+	"net/url"
+
+	"crawler/parser"
+)
+
+// maxSitemapDepth bounds how many levels of nested sitemap indexes are
+// followed below /sitemap.xml.
+const maxSitemapDepth = 3
+
+// seedSitemaps enqueues the pages listed in /sitemap.xml of every seed host
+// of j.
+func (c *Crawler) seedSitemaps(ctx context.Context, j *job) {
+	seen := make(map[string]bool)
+	for _, seed := range j.cfg.SeedUrls {
+		u, err := url.Parse(seed)
+		if err != nil {
+			continue
+		}
+		root := u.Scheme + "://" + u.Host + "/sitemap.xml"
+		if !seen[root] {
+			seen[root] = true
+			c.readSitemap(ctx, j, root, 0, seen)
+		}
+	}
+}
+
+// readSitemap enqueues the URLs of one sitemap, recursing into sitemap
+// indexes up to maxSitemapDepth. Failures are logged and skipped.
+func (c *Crawler) readSitemap(ctx context.Context, j *job, sitemapURL string, depth int, seen map[string]bool) {
+	page, err := c.sitemaps.Fetch(ctx, sitemapURL)
+	if err != nil {
+		j.log.Warn("fetching sitemap failed", "url", sitemapURL, "error", err)
+		return
+	}
+	locs, isIndex, err := parser.ParseSitemapIndex(page.Body)
+	if err != nil {
+		j.log.Warn("reading sitemap failed", "url", sitemapURL, "error", err)
+		return
+	}
+	if !isIndex {
+		added := 0
+		for _, loc := range locs {
+			if j.urls.Add(ctx, loc, 0) {
+				added++
+			}
+		}
+		j.log.Info("sitemap read", "url", sitemapURL, "enqueued", added, "listed", len(locs))
+		return
+	}
+	if depth >= maxSitemapDepth {
+		j.log.Warn("sitemap index nested too deeply, not following", "url", sitemapURL, "max_depth", maxSitemapDepth)
+		return
+	}
+	for _, loc := range locs {
+		if !seen[loc] {
+			seen[loc] = true
+			c.readSitemap(ctx, j, loc, depth+1, seen)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package crawler
+
+import (
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Stats summarizes a crawl.
+type Stats struct {
+	PagesFetched    int
+	PagesStored     int
+	Errors          int
+	BytesDownloaded int64
+	UniqueHosts     int
+	Disallowed      int
+	Rejected        int
+	Trapped         int
+	Duration        time.Duration
+	PagesPerSecond  float64
+	HostErrors      map[string]int // host failures seen by the circuit breaker
+}
+
+// statsCollector accumulates the counters behind Stats as workers report
+// their progress.
+type statsCollector struct {
+	mu      sync.Mutex
+	start   time.Time
+	end     time.Time
+	fetched int
+	stored  int
+	errors  int
+	bytes   int64
+	hosts   map[string]bool
+}
+
+func (s *statsCollector) begin() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.start = time.Now()
+	s.hosts = make(map[string]bool)
+}
+
+func (s *statsCollector) finish() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.end = time.Now()
+}
+
+func (s *statsCollector) fetchedPage(pageURL string, bytes int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fetched++
+	s.bytes += int64(bytes)
+	if u, err := url.Parse(pageURL); err == nil {
+		s.hosts[strings.ToLower(u.Host)] = true
+	}
+}
+
+func (s *statsCollector) storedPage() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stored++
+}
+
+func (s *statsCollector) failed() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errors++
+}
+
+// Stats returns the statistics of the crawl so far, or of the finished
+// crawl once Start has returned.
+func (c *Crawler) Stats() Stats {
+	s := &c.stats
+	s.mu.Lock()
+	stats := Stats{
+		PagesFetched:    s.fetched,
+		PagesStored:     s.stored,
+		Errors:          s.errors,
+		BytesDownloaded: s.bytes,
+		UniqueHosts:     len(s.hosts),
+	}
+	switch {
+	case !s.end.IsZero():
+		stats.Duration = s.end.Sub(s.start)
+	case !s.start.IsZero():
+		stats.Duration = time.Since(s.start)
+	}
+	s.mu.Unlock()
+
+	if stats.Duration > 0 {
+		stats.PagesPerSecond = float64(stats.PagesFetched) / stats.Duration.Seconds()
+	}
+	stats.Disallowed = c.Disallowed()
+	stats.Rejected = c.Rejected()
+	stats.Trapped = c.Trapped()
+	stats.HostErrors = c.HostErrors()
+	return stats
+}
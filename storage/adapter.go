@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"crawler/common"
+)
+
+const (
+	TypePostgres = "postgres"
+	TypeMemory   = "memory"
+)
+
+// New returns the Storage implementation selected by cfg.StorageType,
+// wrapped in a Batcher when cfg.BatchSize is above one. A cfg.OutputFormat
+// takes precedence and writes pages to cfg.OutputPath instead, appending to
+// it when the crawl resumes from cfg.StateFile.
+func New(cfg *common.ConfigManager) (common.Storage, error) {
+	if cfg.OutputFormat != "" {
+		return NewOutputWriter(cfg.OutputFormat, cfg.OutputPath, resuming(cfg))
+	}
+	var store common.BatchStorage
+	switch cfg.StorageType {
+	case TypePostgres:
+		pg, err := NewPostgresStorage(cfg.DBConnectionString, cfg.Log())
+		if err != nil {
+			return nil, err
+		}
+		store = pg
+	case TypeMemory:
+		store = NewMemoryStorage()
+	default:
+		return nil, fmt.Errorf("unknown storage type %q", cfg.StorageType)
+	}
+	if cfg.BatchSize > 1 {
+		return NewBatcher(store, int(cfg.BatchSize), cfg.FlushInterval, cfg.Log()), nil
+	}
+	return store, nil
+}
+
+// resuming reports whether the crawl of cfg will resume from its state file,
+// which is only left behind by a crawl that did not finish.
+func resuming(cfg *common.ConfigManager) bool {
+	if cfg.StateFile == "" || cfg.DryRun {
+		return false
+	}
+	_, err := os.Stat(cfg.StateFile)
+	return err == nil
+}
+
+// Check reports whether New would succeed for cfg without opening anything
+// for writing: postgres is pinged and the directory of an output file must
+// exist.
+func Check(cfg *common.ConfigManager) error {
+	if cfg.OutputFormat != "" {
+		switch cfg.OutputFormat {
+		case FormatJSONL, FormatCSV:
+		default:
+			return fmt.Errorf("unknown output format %q", cfg.OutputFormat)
+		}
+		if cfg.OutputPath == "" || cfg.OutputPath == "-" {
+			return nil
+		}
+		dir := filepath.Dir(cfg.OutputPath)
+		if info, err := os.Stat(dir); err != nil {
+			return fmt.Errorf("opening output: %w", err)
+		} else if !info.IsDir() {
+			return fmt.Errorf("opening output: %s is not a directory", dir)
+		}
+		return nil
+	}
+	switch cfg.StorageType {
+	case TypePostgres:
+		return PingPostgres(cfg.DBConnectionString)
+	case TypeMemory:
+		return nil
+	default:
+		return fmt.Errorf("unknown storage type %q", cfg.StorageType)
+	}
+}
@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"crawler/common"
+)
+
+// maxPendingBatches caps how many batches' worth of pages a Batcher holds
+// while its flushes fail.
+const maxPendingBatches = 10
+
+// ErrBufferFull is returned by Batcher.Save while the underlying storage is
+// failing and the buffer is full. The page was not queued.
+var ErrBufferFull = errors.New("page buffer full")
+
+// Batcher buffers saved pages and writes them to an underlying
+// common.BatchStorage in batches, once size pages are pending or every
+// interval, whichever comes first. Close flushes whatever is left.
+//
+// A page is owned by the Batcher once Save accepts it: a failed flush is
+// logged and its pages are kept for the next one. While flushes fail, at
+// most maxPendingBatches batches are kept and further pages are rejected.
+type Batcher struct {
+	store    common.BatchStorage
+	size     int
+	log      *slog.Logger
+	mu       sync.Mutex
+	pending  []common.PageStorageData
+	flushMu  sync.Mutex
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewBatcher wraps store. An interval of zero disables timed flushes.
+func NewBatcher(store common.BatchStorage, size int, interval time.Duration, logger *slog.Logger) *Batcher {
+	b := &Batcher{
+		store:   store,
+		size:    size,
+		log:     logger,
+		pending: make([]common.PageStorageData, 0, size),
+		stop:    make(chan struct{}),
+	}
+	if interval > 0 {
+		b.wg.Add(1)
+		go b.flushEvery(interval)
+	}
+	return b
+}
+
+// Save queues data and flushes the batch once it is full. It returns an
+// error, without queuing data, only when the buffer is full of pages that
+// failed to flush.
+func (b *Batcher) Save(ctx context.Context, data common.PageStorageData) error {
+	b.mu.Lock()
+	if len(b.pending) >= b.size*maxPendingBatches {
+		b.mu.Unlock()
+		return fmt.Errorf("saving %s: %w", data.URL, ErrBufferFull)
+	}
+	b.pending = append(b.pending, data)
+	full := len(b.pending) >= b.size
+	b.mu.Unlock()
+	if full {
+		if err := b.Flush(ctx); err != nil {
+			b.log.Error("flushing page batch failed, will retry", "error", err)
+		}
+	}
+	return nil
+}
+
+// Flush writes every queued page in one batch. On failure the pages stay
+// queued for the next flush, or are lost if it was the one made by Close.
+func (b *Batcher) Flush(ctx context.Context) error {
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+	b.mu.Lock()
+	batch := b.pending
+	b.pending = make([]common.PageStorageData, 0, b.size)
+	b.mu.Unlock()
+	if len(batch) == 0 {
+		return nil
+	}
+	if err := b.store.SaveBatch(ctx, batch); err != nil {
+		b.mu.Lock()
+		b.pending = append(batch, b.pending...)
+		b.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (b *Batcher) flushEvery(interval time.Duration) {
+	defer b.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := b.Flush(context.Background()); err != nil {
+				b.log.Error("flushing page batch failed", "error", err)
+			}
+		case <-b.stop:
+			return
+		}
+	}
+}
+
+// Validators passes through to the underlying storage, if it supports them.
+func (b *Batcher) Validators(ctx context.Context, url string) (string, string, error) {
+	if v, ok := b.store.(common.ValidatorStorage); ok {
+		return v.Validators(ctx, url)
+	}
+	return "", "", nil
+}
+
+// SaveAlias passes through to the underlying storage, if it supports
+// aliases.
+func (b *Batcher) SaveAlias(ctx context.Context, alias, original string) error {
+	if a, ok := b.store.(common.AliasStorage); ok {
+		return a.SaveAlias(ctx, alias, original)
+	}
+	return nil
+}
+
+// Close flushes the pending pages and closes the underlying storage.
+func (b *Batcher) Close() error {
+	b.stopOnce.Do(func() { close(b.stop) })
+	b.wg.Wait()
+	err := b.Flush(context.Background())
+	if closeErr := b.store.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
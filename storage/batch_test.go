@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"crawler/common"
+)
+
+// countingStore is a MemoryStorage that counts its batch writes and fails
+// them while failing is set.
+type countingStore struct {
+	*MemoryStorage
+	mu      sync.Mutex
+	batches int
+	failing bool
+}
+
+func (s *countingStore) SaveBatch(ctx context.Context, batch []common.PageStorageData) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failing {
+		return errors.New("database unavailable")
+	}
+	s.batches++
+	return s.MemoryStorage.SaveBatch(ctx, batch)
+}
+
+func (s *countingStore) setFailing(failing bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failing = failing
+}
+
+func (s *countingStore) batchCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.batches
+}
+
+func newCountingStore() *countingStore {
+	return &countingStore{MemoryStorage: NewMemoryStorage()}
+}
+
+func page(i int) common.PageStorageData {
+	return common.PageStorageData{URL: fmt.Sprintf("http://example.com/%d", i)}
+}
+
+var discard = slog.New(slog.DiscardHandler)
+
+func TestBatcherFlushCount(t *testing.T) {
+	const size = 10
+	for _, n := range []int{0, 1, 9, 10, 11, 25, 30} {
+		store := newCountingStore()
+		b := NewBatcher(store, size, 0, discard)
+		for i := range n {
+			if err := b.Save(context.Background(), page(i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := b.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if want := (n + size - 1) / size; store.batchCount() != want {
+			t.Errorf("%d pages in batches of %d: %d flushes, want %d", n, size, store.batchCount(), want)
+		}
+		if got := len(store.Pages()); got != n {
+			t.Errorf("%d pages saved, %d stored", n, got)
+		}
+	}
+}
+
+func TestBatcherFlushInterval(t *testing.T) {
+	store := newCountingStore()
+	b := NewBatcher(store, 100, 10*time.Millisecond, discard)
+	defer b.Close()
+	b.Save(context.Background(), page(1))
+	deadline := time.Now().Add(2 * time.Second)
+	for len(store.Pages()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("partial batch not flushed after the interval")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestBatcherKeepsPagesWhileFlushesFail(t *testing.T) {
+	const size = 2
+	store := newCountingStore()
+	store.setFailing(true)
+	b := NewBatcher(store, size, 0, discard)
+	n := 0
+	for ; n < size*maxPendingBatches; n++ {
+		if err := b.Save(context.Background(), page(n)); err != nil {
+			t.Fatalf("Save %d: %v", n, err)
+		}
+	}
+	if err := b.Save(context.Background(), page(n)); !errors.Is(err, ErrBufferFull) {
+		t.Errorf("Save with a full buffer = %v, want ErrBufferFull", err)
+	}
+
+	store.setFailing(false)
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(store.Pages()); got != n {
+		t.Errorf("stored %d pages after recovering, want %d", got, n)
+	}
+}
@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"context"
+	"sync"
+
+	"crawler/common"
+)
+
+// MemoryStorage keeps pages in memory, keyed by URL. It is meant for tests
+// and short experimental crawls.
+type MemoryStorage struct {
+	mu      sync.Mutex
+	pages   map[string]common.PageStorageData
+	aliases map[string]string
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		pages:   make(map[string]common.PageStorageData),
+		aliases: make(map[string]string),
+	}
+}
+
+func (s *MemoryStorage) Save(ctx context.Context, data common.PageStorageData) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pages[data.URL] = data
+	return nil
+}
+
+func (s *MemoryStorage) SaveBatch(ctx context.Context, batch []common.PageStorageData) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, data := range batch {
+		s.pages[data.URL] = data
+	}
+	return nil
+}
+
+func (s *MemoryStorage) Validators(ctx context.Context, url string) (string, string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", "", err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data := s.pages[url]
+	return data.ETag, data.LastModified, nil
+}
+
+func (s *MemoryStorage) SaveAlias(ctx context.Context, alias, original string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.aliases[alias] = original
+	return nil
+}
+
+func (s *MemoryStorage) Close() error {
+	return nil
+}
+
+// Get returns the page stored for url, if any.
+func (s *MemoryStorage) Get(url string) (common.PageStorageData, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.pages[url]
+	return data, ok
+}
+
+// Alias returns the URL whose stored page alias duplicates, if any.
+func (s *MemoryStorage) Alias(alias string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	original, ok := s.aliases[alias]
+	return original, ok
+}
+
+// Pages returns a copy of every stored page.
+func (s *MemoryStorage) Pages() []common.PageStorageData {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pages := make([]common.PageStorageData, 0, len(s.pages))
+	for _, data := range s.pages {
+		pages = append(pages, data)
+	}
+	return pages
+}
@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"crawler/common"
+)
+
+const (
+	FormatJSONL = "jsonl"
+	FormatCSV   = "csv"
+)
+
+// pageRecord is the exported form of a stored page.
+type pageRecord struct {
+	URL          string   `json:"url"`
+	Title        string   `json:"title"`
+	Description  string   `json:"description,omitempty"`
+	CanonicalURL string   `json:"canonical_url,omitempty"`
+	LinkCount    int      `json:"link_count"`
+	ContentHash  string   `json:"content_hash,omitempty"`
+	ETag         string   `json:"etag,omitempty"`
+	LastModified string   `json:"last_modified,omitempty"`
+	Language     string   `json:"language,omitempty"`
+	Links        []string `json:"links,omitempty"`
+	JobID        string   `json:"job_id,omitempty"`
+}
+
+var csvHeader = []string{"url", "title", "description", "canonical_url", "link_count", "content_hash", "etag", "last_modified", "language", "links", "job_id"}
+
+func newPageRecord(data common.PageStorageData) pageRecord {
+	return pageRecord{
+		URL:          data.URL,
+		Title:        data.Title,
+		Description:  data.Description,
+		CanonicalURL: data.CanonicalURL,
+		LinkCount:    data.LinkCount,
+		ContentHash:  data.ContentHash,
+		ETag:         data.ETag,
+		LastModified: data.LastModified,
+		Language:     data.Language,
+		Links:        data.Links,
+		JobID:        data.JobID,
+	}
+}
+
+// JSONLWriter writes every saved page to a stream as one JSON object per
+// line.
+type JSONLWriter struct {
+	mu  sync.Mutex
+	w   io.WriteCloser
+	enc *json.Encoder
+}
+
+func NewJSONLWriter(w io.WriteCloser) *JSONLWriter {
+	return &JSONLWriter{w: w, enc: json.NewEncoder(w)}
+}
+
+func (s *JSONLWriter) Save(ctx context.Context, data common.PageStorageData) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.enc.Encode(newPageRecord(data)); err != nil {
+		return fmt.Errorf("writing %s: %w", data.URL, err)
+	}
+	return nil
+}
+
+func (s *JSONLWriter) Close() error {
+	return s.w.Close()
+}
+
+// CSVWriter writes every saved page to a stream as a CSV row, after a
+// header row. Recorded links share one column, separated by spaces.
+type CSVWriter struct {
+	mu     sync.Mutex
+	w      io.WriteCloser
+	csv    *csv.Writer
+	header bool
+}
+
+func NewCSVWriter(w io.WriteCloser) *CSVWriter {
+	return &CSVWriter{w: w, csv: csv.NewWriter(w)}
+}
+
+func (s *CSVWriter) Save(ctx context.Context, data common.PageStorageData) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.header {
+		if err := s.csv.Write(csvHeader); err != nil {
+			return fmt.Errorf("writing CSV header: %w", err)
+		}
+		s.header = true
+	}
+	r := newPageRecord(data)
+	row := []string{r.URL, r.Title, r.Description, r.CanonicalURL, strconv.Itoa(r.LinkCount), r.ContentHash, r.ETag, r.LastModified, r.Language, strings.Join(r.Links, " "), r.JobID}
+	if err := s.csv.Write(row); err != nil {
+		return fmt.Errorf("writing %s: %w", data.URL, err)
+	}
+	s.csv.Flush()
+	if err := s.csv.Error(); err != nil {
+		return fmt.Errorf("writing %s: %w", data.URL, err)
+	}
+	return nil
+}
+
+// Close writes the header if no page was saved and closes the stream.
+func (s *CSVWriter) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.header {
+		s.csv.Write(csvHeader)
+		s.header = true
+	}
+	s.csv.Flush()
+	err := s.csv.Error()
+	if closeErr := s.w.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// NewOutputWriter returns the writer for format, writing to path or to
+// stdout when path is "-" or empty. An existing file is truncated unless
+// resume is set, in which case pages are appended to it and a CSV header is
+// only written if it is empty.
+func NewOutputWriter(format, path string, resume bool) (common.Storage, error) {
+	var w io.WriteCloser = nopCloser{os.Stdout}
+	hasHeader := false
+	if path != "" && path != "-" {
+		flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		if resume {
+			flag = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		}
+		f, err := os.OpenFile(path, flag, 0o666)
+		if err != nil {
+			return nil, fmt.Errorf("opening output: %w", err)
+		}
+		if info, err := f.Stat(); err == nil && info.Size() > 0 {
+			hasHeader = true
+		}
+		w = f
+	}
+	switch format {
+	case FormatJSONL:
+		return NewJSONLWriter(w), nil
+	case FormatCSV:
+		cw := NewCSVWriter(w)
+		cw.header = hasHeader
+		return cw, nil
+	default:
+		w.Close()
+		return nil, fmt.Errorf("unknown output format %q", format)
+	}
+}
+
+// nopCloser keeps stdout open when a writer is closed.
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
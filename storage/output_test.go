@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"crawler/common"
+)
+
+var tricky = common.PageStorageData{
+	URL:       "http://example.com/a",
+	Title:     "Fish, chips and \"quotes\"\non two lines",
+	LinkCount: 2,
+	Links:     []string{"http://example.com/b", "http://example.com/c"},
+	JobID:     "docs",
+}
+
+// writePages saves pages to a new writer for format at path and closes it.
+func writePages(t *testing.T, format, path string, resume bool, pages ...common.PageStorageData) {
+	t.Helper()
+	w, err := NewOutputWriter(format, path, resume)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range pages {
+		if err := w.Save(context.Background(), p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readCSV(t *testing.T, path string) [][]string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatalf("reading back CSV: %v", err)
+	}
+	return rows
+}
+
+func readJSONL(t *testing.T, path string) []pageRecord {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var records []pageRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r pageRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatalf("line %d: %v", len(records)+1, err)
+		}
+		records = append(records, r)
+	}
+	return records
+}
+
+func TestCSVOutput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pages.csv")
+	writePages(t, FormatCSV, path, false, tricky)
+
+	rows := readCSV(t, path)
+	if len(rows) != 2 {
+		t.Fatalf("got %d rows, want a header and one page", len(rows))
+	}
+	if rows[0][0] != "url" || len(rows[0]) != len(csvHeader) {
+		t.Errorf("header = %q", rows[0])
+	}
+	row := rows[1]
+	if row[0] != tricky.URL || row[1] != tricky.Title || row[4] != "2" || row[9] != "http://example.com/b http://example.com/c" || row[10] != "docs" {
+		t.Errorf("row = %q", row)
+	}
+}
+
+func TestJSONLOutput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pages.jsonl")
+	second := common.PageStorageData{URL: "http://example.com/b", Title: "b"}
+	writePages(t, FormatJSONL, path, false, tricky, second)
+
+	records := readJSONL(t, path)
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2", len(records))
+	}
+	if r := records[0]; r.URL != tricky.URL || r.Title != tricky.Title || len(r.Links) != 2 || r.JobID != "docs" {
+		t.Errorf("first record = %+v", r)
+	}
+	if records[1].URL != second.URL {
+		t.Errorf("second record = %+v", records[1])
+	}
+}
+
+func TestOutputResume(t *testing.T) {
+	dir := t.TempDir()
+	first, second := common.PageStorageData{URL: "http://example.com/1"}, common.PageStorageData{URL: "http://example.com/2"}
+
+	csvPath := filepath.Join(dir, "pages.csv")
+	writePages(t, FormatCSV, csvPath, false, first)
+	writePages(t, FormatCSV, csvPath, true, second)
+	if rows := readCSV(t, csvPath); len(rows) != 3 || rows[1][0] != first.URL || rows[2][0] != second.URL {
+		t.Errorf("resumed CSV = %q, want one header and both pages", rows)
+	}
+
+	jsonlPath := filepath.Join(dir, "pages.jsonl")
+	writePages(t, FormatJSONL, jsonlPath, false, first)
+	writePages(t, FormatJSONL, jsonlPath, true, second)
+	if records := readJSONL(t, jsonlPath); len(records) != 2 {
+		t.Errorf("resumed JSONL has %d records, want 2", len(records))
+	}
+
+	// Without resuming, the file is started over.
+	writePages(t, FormatCSV, csvPath, false, second)
+	if rows := readCSV(t, csvPath); len(rows) != 2 || rows[1][0] != second.URL {
+		t.Errorf("rewritten CSV = %q, want a header and the second page", rows)
+	}
+}
@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/lib/pq"
+
+	"crawler/common"
+)
+
+// schema is applied in order on startup; every statement is idempotent so
+// existing tables pick up new columns.
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS pages (
+		url        TEXT PRIMARY KEY,
+		title      TEXT NOT NULL,
+		crawled_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`,
+	`ALTER TABLE pages ADD COLUMN IF NOT EXISTS description TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE pages ADD COLUMN IF NOT EXISTS canonical_url TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE pages ADD COLUMN IF NOT EXISTS link_count INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE pages ADD COLUMN IF NOT EXISTS content_hash TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE pages ADD COLUMN IF NOT EXISTS etag TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE pages ADD COLUMN IF NOT EXISTS last_modified TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE pages ADD COLUMN IF NOT EXISTS language TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE pages ADD COLUMN IF NOT EXISTS links TEXT[] NOT NULL DEFAULT '{}'`,
+	`ALTER TABLE pages ADD COLUMN IF NOT EXISTS job_id TEXT NOT NULL DEFAULT ''`,
+	`CREATE TABLE IF NOT EXISTS page_aliases (
+		url          TEXT PRIMARY KEY,
+		original_url TEXT NOT NULL,
+		created_at   TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`,
+}
+
+const upsertPage = `
+INSERT INTO pages (url, title, description, canonical_url, link_count, content_hash, etag, last_modified, language, links, job_id, crawled_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, now())
+ON CONFLICT (url) DO UPDATE SET
+	title = EXCLUDED.title,
+	description = EXCLUDED.description,
+	canonical_url = EXCLUDED.canonical_url,
+	link_count = EXCLUDED.link_count,
+	content_hash = EXCLUDED.content_hash,
+	etag = EXCLUDED.etag,
+	last_modified = EXCLUDED.last_modified,
+	language = EXCLUDED.language,
+	links = EXCLUDED.links,
+	job_id = EXCLUDED.job_id,
+	crawled_at = EXCLUDED.crawled_at`
+
+const selectValidators = `SELECT etag, last_modified FROM pages WHERE url = $1`
+
+const upsertAlias = `
+INSERT INTO page_aliases (url, original_url) VALUES ($1, $2)
+ON CONFLICT (url) DO UPDATE SET original_url = EXCLUDED.original_url`
+
+// connectTimeout bounds the connection check made when storage is opened.
+const connectTimeout = 10 * time.Second
+
+// PostgresStorage stores pages in a PostgreSQL "pages" table.
+type PostgresStorage struct {
+	db  *sql.DB
+	log *slog.Logger
+}
+
+// NewPostgresStorage connects using connString, checks that the database is
+// reachable and brings the pages table up to date, so a bad connection
+// string fails before anything is crawled. Errors never include the
+// connection string's password.
+func NewPostgresStorage(connString string, logger *slog.Logger) (*PostgresStorage, error) {
+	db, err := openPostgres(connString)
+	if err != nil {
+		return nil, err
+	}
+	for _, stmt := range schema {
+		if _, err := db.Exec(stmt); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("migrating pages table: %s", common.RedactError(err, connString))
+		}
+	}
+	logger.Info("connected to postgres", "db", common.RedactConnString(connString))
+	return &PostgresStorage{db: db, log: logger}, nil
+}
+
+// PingPostgres checks that the database at connString is reachable, without
+// touching its tables.
+func PingPostgres(connString string) error {
+	db, err := openPostgres(connString)
+	if err != nil {
+		return err
+	}
+	return db.Close()
+}
+
+// openPostgres opens connString and pings it within connectTimeout.
+func openPostgres(connString string) (*sql.DB, error) {
+	db, err := sql.Open("postgres", connString)
+	if err != nil {
+		return nil, fmt.Errorf("opening database: %s", common.RedactError(err, connString))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), connectTimeout)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("connecting to database %s: %s", common.RedactConnString(connString), common.RedactError(err, connString))
+	}
+	return db, nil
+}
+
+func (s *PostgresStorage) Save(ctx context.Context, data common.PageStorageData) error {
+	if _, err := s.db.ExecContext(ctx, upsertPage, pageArgs(data)...); err != nil {
+		return fmt.Errorf("saving %s: %w", data.URL, err)
+	}
+	s.log.Debug("page stored", "url", data.URL)
+	return nil
+}
+
+// SaveBatch upserts batch in a single transaction.
+func (s *PostgresStorage) SaveBatch(ctx context.Context, batch []common.PageStorageData) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("saving batch: %w", err)
+	}
+	defer tx.Rollback()
+	stmt, err := tx.PrepareContext(ctx, upsertPage)
+	if err != nil {
+		return fmt.Errorf("saving batch: %w", err)
+	}
+	defer stmt.Close()
+	for _, data := range batch {
+		if _, err := stmt.ExecContext(ctx, pageArgs(data)...); err != nil {
+			return fmt.Errorf("saving %s: %w", data.URL, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("saving batch: %w", err)
+	}
+	s.log.Debug("page batch stored", "pages", len(batch))
+	return nil
+}
+
+// pageArgs returns the parameters of upsertPage for data.
+func pageArgs(data common.PageStorageData) []any {
+	links := data.Links
+	if links == nil {
+		// pq encodes a nil slice as NULL.
+		links = []string{}
+	}
+	return []any{data.URL, data.Title, data.Description, data.CanonicalURL, data.LinkCount, data.ContentHash, data.ETag, data.LastModified, data.Language, pq.Array(links), data.JobID}
+}
+
+func (s *PostgresStorage) Validators(ctx context.Context, url string) (string, string, error) {
+	var etag, lastModified string
+	err := s.db.QueryRowContext(ctx, selectValidators, url).Scan(&etag, &lastModified)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", "", nil
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("loading validators of %s: %w", url, err)
+	}
+	return etag, lastModified, nil
+}
+
+func (s *PostgresStorage) SaveAlias(ctx context.Context, alias, original string) error {
+	if _, err := s.db.ExecContext(ctx, upsertAlias, alias, original); err != nil {
+		return fmt.Errorf("saving alias %s: %w", alias, err)
+	}
+	return nil
+}
+
+func (s *PostgresStorage) Close() error {
+	return s.db.Close()
+}
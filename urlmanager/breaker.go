@@ -0,0 +1,119 @@
+package urlmanager
+
+import (
+	"maps"
+	"strings"
+	"time"
+)
+
+// circuitBreaker stops fetching from hosts that keep failing. After
+// threshold consecutive failures a host's circuit opens and its URLs stay
+// queued for cooldown. Then one probe URL is let through: success closes
+// the circuit, failure opens it for another cooldown.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	hosts     map[string]*hostCircuit
+	errors    map[string]int
+}
+
+type hostCircuit struct {
+	failures  int // consecutive
+	openUntil time.Time
+	probe     string // URL let through while half open
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		hosts:     make(map[string]*hostCircuit),
+		errors:    make(map[string]int),
+	}
+}
+
+// allows reports whether a URL of host may be handed out now.
+func (b *circuitBreaker) allows(host string, now time.Time) bool {
+	h, ok := b.hosts[host]
+	if !ok || h.failures < b.threshold {
+		return true
+	}
+	return !now.Before(h.openUntil) && h.probe == ""
+}
+
+// dispatched notes that item was handed out, which makes it the probe when
+// its host's circuit is half open.
+func (b *circuitBreaker) dispatched(item Entry) {
+	if h, ok := b.hosts[item.Host]; ok && h.failures >= b.threshold {
+		h.probe = item.URL
+	}
+}
+
+// holds reports whether item, already handed out, must go back to the
+// queue because its host's circuit opened in the meantime.
+func (b *circuitBreaker) holds(item Entry) bool {
+	h, ok := b.hosts[item.Host]
+	return ok && h.failures >= b.threshold && item.URL != h.probe
+}
+
+// done clears item's probe once it is finished, reported or not, so a
+// skipped probe does not keep its host's circuit shut.
+func (b *circuitBreaker) done(item Entry) {
+	if h, ok := b.hosts[item.Host]; ok && h.probe == item.URL {
+		h.probe = ""
+	}
+}
+
+// RecordFetch reports the outcome of fetching a URL of host. A failure is a
+// sign the host itself is in trouble, such as a 5xx response or a DNS
+// error, rather than a problem with one page. It does nothing when the
+// circuit breaker is disabled.
+func (um *UrlManager) RecordFetch(host string, failed bool) {
+	if um.breaker == nil {
+		return
+	}
+	host = strings.ToLower(host)
+	um.mu.Lock()
+	defer um.mu.Unlock()
+	b := um.breaker
+	h, ok := b.hosts[host]
+	if !failed {
+		if ok {
+			if h.failures >= b.threshold {
+				um.log.Info("host recovered, resuming", "host", host)
+			}
+			delete(b.hosts, host)
+			um.cond.Broadcast()
+		}
+		return
+	}
+	b.errors[host]++
+	if !ok {
+		h = &hostCircuit{}
+		b.hosts[host] = h
+	}
+	h.failures++
+	h.probe = ""
+	if h.failures < b.threshold {
+		return
+	}
+	h.openUntil = time.Now().Add(b.cooldown)
+	um.log.Warn("host failing, pausing it", "host", host, "failures", h.failures, "cooldown", b.cooldown)
+	// Wake the dispatcher when the cooldown is over, in case nothing else
+	// does.
+	time.AfterFunc(b.cooldown, func() {
+		um.mu.Lock()
+		um.cond.Broadcast()
+		um.mu.Unlock()
+	})
+}
+
+// HostErrors returns how many failures RecordFetch has seen per host.
+func (um *UrlManager) HostErrors() map[string]int {
+	if um.breaker == nil {
+		return nil
+	}
+	um.mu.Lock()
+	defer um.mu.Unlock()
+	return maps.Clone(um.breaker.errors)
+}
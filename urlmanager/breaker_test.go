@@ -0,0 +1,53 @@
+package urlmanager
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerProbe(t *testing.T) {
+	const cooldown = time.Minute
+	cfg := testConfig()
+	cfg.BreakerThreshold = 2
+	cfg.BreakerCooldown = cooldown
+	um := newTestManager(t, cfg)
+	b := um.breaker
+	first := Entry{URL: "http://example.com/1", Host: "example.com"}
+	second := Entry{URL: "http://example.com/2", Host: "example.com"}
+
+	um.RecordFetch("example.com", true)
+	if !b.allows("example.com", time.Now()) {
+		t.Fatal("circuit open after one failure, below the threshold")
+	}
+	um.RecordFetch("Example.com", true)
+	now := time.Now()
+	if b.allows("example.com", now) || !b.allows("other.example", now) {
+		t.Fatal("circuit not open for the failing host alone")
+	}
+
+	// After the cooldown a single probe goes through.
+	later := now.Add(cooldown)
+	if !b.allows("example.com", later) {
+		t.Fatal("no probe allowed after the cooldown")
+	}
+	b.dispatched(first)
+	if b.allows("example.com", later) || b.holds(first) || !b.holds(second) {
+		t.Fatal("more than the probe let through while half open")
+	}
+
+	// A failed probe opens the circuit for another cooldown.
+	um.RecordFetch("example.com", true)
+	b.done(first)
+	if b.allows("example.com", time.Now()) {
+		t.Fatal("circuit closed after the probe failed")
+	}
+
+	// A successful one closes it.
+	um.RecordFetch("example.com", false)
+	if !b.allows("example.com", time.Now()) || b.holds(second) {
+		t.Error("circuit still open after the host recovered")
+	}
+	if errs := um.HostErrors(); errs["example.com"] != 3 {
+		t.Errorf("HostErrors() = %v, want 3 for example.com", errs)
+	}
+}
@@ -0,0 +1,50 @@
+package urlmanager
+
+import (
+	"strings"
+	"time"
+)
+
+// adaptiveDelay derives a per-host crawl delay from the latency of the
+// host's responses: factor times the last latency, clamped to [min, max].
+type adaptiveDelay struct {
+	min, max time.Duration
+	factor   float64
+}
+
+func (a *adaptiveDelay) next(latency time.Duration) time.Duration {
+	d := time.Duration(float64(latency) * a.factor)
+	if d < a.min {
+		d = a.min
+	}
+	if a.max > 0 && d > a.max {
+		d = a.max
+	}
+	return d
+}
+
+// RecordLatency updates host's adaptive delay after a response took
+// latency to arrive. It does nothing unless adaptive delays are enabled.
+func (um *UrlManager) RecordLatency(host string, latency time.Duration) {
+	if um.adaptive == nil {
+		return
+	}
+	um.mu.Lock()
+	defer um.mu.Unlock()
+	um.hostDelay[strings.ToLower(host)] = um.adaptive.next(latency)
+}
+
+// HostDelay returns the adaptive delay before the next request to host, or
+// the configured minimum for hosts without a response yet. It reports false
+// when adaptive delays are disabled.
+func (um *UrlManager) HostDelay(host string) (time.Duration, bool) {
+	if um.adaptive == nil {
+		return 0, false
+	}
+	um.mu.Lock()
+	defer um.mu.Unlock()
+	if d, ok := um.hostDelay[strings.ToLower(host)]; ok {
+		return d, true
+	}
+	return um.adaptive.min, true
+}
@@ -0,0 +1,281 @@
+package urlmanager
+
+import (
+	"bytes"
+	"container/heap"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// frontierBucket holds one nested bucket of entries per host.
+var frontierBucket = []byte("hosts")
+
+// errFrontierClosed is returned by a DiskFrontier used after Close.
+var errFrontierClosed = errors.New("frontier is closed")
+
+// DiskFrontier is a Frontier stored in a BoltDB file, so a queue too large
+// for memory lives on disk and outlasts the process. Every host has a
+// bucket of its entries keyed by priority and sequence number, which makes
+// key order the pop order. Only the first key of each host is kept in
+// memory, in a heap that finds the first eligible host without reading the
+// entries of the others.
+//
+// Commits are not fsynced, which keeps pushes cheap: the file survives the
+// process crashing but not necessarily the machine. Sync flushes it.
+type DiskFrontier struct {
+	mu    sync.Mutex
+	db    *bolt.DB
+	len   int
+	hosts map[string]*diskHost
+	order diskHostHeap
+}
+
+// diskHost is the in-memory index entry of a host with queued entries.
+type diskHost struct {
+	host  string
+	first []byte // key of the host's first entry
+	index int    // position in DiskFrontier.order
+}
+
+// OpenDiskFrontier opens the frontier at path, creating it if needed.
+// Entries left by an earlier run are kept.
+func OpenDiskFrontier(path string) (*DiskFrontier, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second, NoSync: true})
+	if err != nil {
+		return nil, fmt.Errorf("opening frontier %s: %w", path, err)
+	}
+	f := &DiskFrontier{db: db, hosts: make(map[string]*diskHost)}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(frontierBucket)
+		if err != nil {
+			return err
+		}
+		var empty [][]byte
+		err = b.ForEachBucket(func(name []byte) error {
+			hb := b.Bucket(name)
+			first, _ := hb.Cursor().First()
+			if first == nil {
+				empty = append(empty, bytes.Clone(name))
+				return nil
+			}
+			f.len += hb.Stats().KeyN
+			f.index(hostOfBucket(name), bytes.Clone(first))
+			return nil
+		})
+		for _, name := range empty {
+			if err == nil {
+				err = b.DeleteBucket(name)
+			}
+		}
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("opening frontier %s: %w", path, err)
+	}
+	return f, nil
+}
+
+// frontierKey orders entries by descending priority, then ascending seq.
+func frontierKey(e Entry) []byte {
+	key := make([]byte, 16)
+	// Flipping the sign bit makes the unsigned order match the signed one;
+	// inverting the result puts higher priorities first.
+	binary.BigEndian.PutUint64(key, ^(uint64(int64(e.Priority)) ^ 1<<63))
+	binary.BigEndian.PutUint64(key[8:], e.Seq)
+	return key
+}
+
+// Bucket names carry a prefix, as bolt does not allow the empty name an
+// entry without a host would get.
+func hostBucket(host string) []byte { return append([]byte("h:"), host...) }
+
+func hostOfBucket(name []byte) string { return string(name[2:]) }
+
+// index records that host's first entry now has key first, adding host to
+// the heap if it is new. Callers must hold f.mu.
+func (f *DiskFrontier) index(host string, first []byte) {
+	h, ok := f.hosts[host]
+	if !ok {
+		h = &diskHost{host: host, first: first}
+		f.hosts[host] = h
+		heap.Push(&f.order, h)
+		return
+	}
+	h.first = first
+	heap.Fix(&f.order, h.index)
+}
+
+func (f *DiskFrontier) Push(e Entry) error {
+	value, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("encoding frontier entry: %w", err)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.db == nil {
+		return errFrontierClosed
+	}
+	key := frontierKey(e)
+	added := false
+	err = f.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.Bucket(frontierBucket).CreateBucketIfNotExists(hostBucket(e.Host))
+		if err != nil {
+			return err
+		}
+		added = b.Get(key) == nil
+		return b.Put(key, value)
+	})
+	if err != nil {
+		return fmt.Errorf("writing frontier: %w", err)
+	}
+	if added {
+		f.len++
+	}
+	if h, ok := f.hosts[e.Host]; !ok || bytes.Compare(key, h.first) < 0 {
+		f.index(e.Host, key)
+	}
+	return nil
+}
+
+func (f *DiskFrontier) Pop(eligible func(host string) bool) (Entry, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.db == nil {
+		return Entry{}, false, errFrontierClosed
+	}
+	var skipped []*diskHost
+	defer func() {
+		for _, h := range skipped {
+			heap.Push(&f.order, h)
+		}
+	}()
+	for f.order.Len() > 0 {
+		h := heap.Pop(&f.order).(*diskHost)
+		skipped = append(skipped, h)
+		if !eligible(h.host) {
+			continue
+		}
+		var item Entry
+		var next []byte
+		err := f.db.Update(func(tx *bolt.Tx) error {
+			b := tx.Bucket(frontierBucket)
+			name := hostBucket(h.host)
+			c := b.Bucket(name).Cursor()
+			k, v := c.First()
+			if k == nil {
+				return errors.New("host bucket is empty")
+			}
+			if err := json.Unmarshal(v, &item); err != nil {
+				return fmt.Errorf("decoding frontier entry: %w", err)
+			}
+			if err := c.Delete(); err != nil {
+				return err
+			}
+			if k, _ = c.First(); k == nil {
+				return b.DeleteBucket(name)
+			}
+			next = bytes.Clone(k)
+			return nil
+		})
+		if err != nil {
+			return Entry{}, false, fmt.Errorf("reading frontier: %w", err)
+		}
+		f.len--
+		if next == nil {
+			skipped = skipped[:len(skipped)-1]
+			delete(f.hosts, h.host)
+		} else {
+			h.first = next
+		}
+		return item, true, nil
+	}
+	return Entry{}, false, nil
+}
+
+func (f *DiskFrontier) Len() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.len
+}
+
+// Reset removes every entry.
+func (f *DiskFrontier) Reset() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.db == nil {
+		return errFrontierClosed
+	}
+	err := f.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(frontierBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucket(frontierBucket)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("clearing frontier: %w", err)
+	}
+	f.len = 0
+	f.hosts = make(map[string]*diskHost)
+	f.order = f.order[:0]
+	return nil
+}
+
+// Sync flushes the frontier to stable storage.
+func (f *DiskFrontier) Sync() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.db == nil {
+		return errFrontierClosed
+	}
+	return f.db.Sync()
+}
+
+// Close syncs and closes the file. Later calls return an error.
+func (f *DiskFrontier) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.db == nil {
+		return errFrontierClosed
+	}
+	err := f.db.Sync()
+	if closeErr := f.db.Close(); err == nil {
+		err = closeErr
+	}
+	f.db = nil
+	return err
+}
+
+// diskHostHeap implements heap.Interface over indexed hosts, ordered by the
+// key of their first entry.
+type diskHostHeap []*diskHost
+
+func (h diskHostHeap) Len() int { return len(h) }
+
+func (h diskHostHeap) Less(i, j int) bool { return bytes.Compare(h[i].first, h[j].first) < 0 }
+
+func (h diskHostHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *diskHostHeap) Push(x any) {
+	d := x.(*diskHost)
+	d.index = len(*h)
+	*h = append(*h, d)
+}
+
+func (h *diskHostHeap) Pop() any {
+	old := *h
+	d := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return d
+}
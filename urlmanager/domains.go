@@ -0,0 +1,54 @@
+package urlmanager
+
+import (
+	"net/url"
+	"strings"
+)
+
+// domainFilter restricts crawling to a set of hosts, optionally including
+// their subdomains.
+type domainFilter struct {
+	domains    map[string]bool
+	subdomains bool
+}
+
+// newDomainFilter allows domains, or the hosts of seeds when domains is
+// empty. Ports are ignored.
+func newDomainFilter(domains, seeds []string, subdomains bool) *domainFilter {
+	f := &domainFilter{domains: make(map[string]bool), subdomains: subdomains}
+	for _, d := range domains {
+		if d = strings.Trim(strings.ToLower(strings.TrimSpace(d)), "."); d != "" {
+			f.domains[d] = true
+		}
+	}
+	if len(f.domains) == 0 {
+		for _, seed := range seeds {
+			if u, err := url.Parse(seed); err == nil && u.Hostname() != "" {
+				f.domains[strings.ToLower(u.Hostname())] = true
+			}
+		}
+	}
+	return f
+}
+
+// allows reports whether host (with or without a port) is in the allow
+// list. An empty allow list allows every host.
+func (f *domainFilter) allows(host string) bool {
+	if len(f.domains) == 0 {
+		return true
+	}
+	host = strings.ToLower((&url.URL{Host: host}).Hostname())
+	if f.domains[host] {
+		return true
+	}
+	if !f.subdomains {
+		return false
+	}
+	for i := strings.IndexByte(host, '.'); i >= 0; i = strings.IndexByte(host, '.') {
+		host = host[i+1:]
+		if f.domains[host] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,155 @@
+package urlmanager
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"path/filepath"
+	"testing"
+)
+
+// frontierEntries returns n entries spread over a few hosts with clashing
+// priorities, so both the priority and the seq ordering are exercised.
+func frontierEntries(n int) []Entry {
+	r := rand.New(rand.NewPCG(1, 2))
+	entries := make([]Entry, n)
+	for i := range entries {
+		host := fmt.Sprintf("h%d.example", r.IntN(5))
+		entries[i] = Entry{
+			URL:      fmt.Sprintf("http://%s/%d", host, i),
+			Host:     host,
+			Depth:    r.IntN(4),
+			Priority: r.IntN(7) - 3,
+			Seq:      uint64(i),
+		}
+	}
+	return entries
+}
+
+func openDisk(t *testing.T, path string) *DiskFrontier {
+	t.Helper()
+	f, err := OpenDiskFrontier(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func pop(t *testing.T, f Frontier, eligible func(string) bool) (Entry, bool) {
+	t.Helper()
+	e, ok, err := f.Pop(eligible)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e, ok
+}
+
+func TestFrontiersPopInSameOrder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "frontier.db")
+	memory, disk := NewMemoryFrontier(), openDisk(t, path)
+	defer func() { disk.Close() }()
+	entries := frontierEntries(300)
+	for _, e := range entries[:200] {
+		memory.Push(e)
+		if err := disk.Push(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Hosts become ineligible in turn, like hosts at their concurrency
+	// limit, and the rest of the entries arrive halfway through.
+	r := rand.New(rand.NewPCG(3, 4))
+	for i := 0; memory.Len() > 0 || i < 100; i++ {
+		if i == 100 {
+			for _, e := range entries[200:] {
+				memory.Push(e)
+				disk.Push(e)
+			}
+			// Reopening must rebuild the same order from the file.
+			if err := disk.Close(); err != nil {
+				t.Fatal(err)
+			}
+			disk = openDisk(t, path)
+		}
+		blocked := fmt.Sprintf("h%d.example", r.IntN(5))
+		eligible := func(host string) bool { return host != blocked }
+		want, wantOK := pop(t, memory, eligible)
+		got, gotOK := pop(t, disk, eligible)
+		if got != want || gotOK != wantOK {
+			t.Fatalf("pop %d: disk returned %+v, %v; memory returned %+v, %v", i, got, gotOK, want, wantOK)
+		}
+		if wantOK && want.Host == blocked {
+			t.Fatalf("pop %d: returned %s from ineligible host", i, want.URL)
+		}
+		if disk.Len() != memory.Len() {
+			t.Fatalf("pop %d: disk has %d entries, memory %d", i, disk.Len(), memory.Len())
+		}
+	}
+}
+
+func TestFrontierPopOrder(t *testing.T) {
+	entries := []Entry{
+		{URL: "a1", Host: "a", Priority: 0, Seq: 0},
+		{URL: "b1", Host: "b", Priority: 0, Seq: 1},
+		{URL: "a2", Host: "a", Priority: 1, Seq: 2},
+		{URL: "b2", Host: "b", Priority: -1, Seq: 3},
+		{URL: "a3", Host: "a", Priority: 0, Seq: 4},
+	}
+	frontiers := map[string]func(t *testing.T) Frontier{
+		"memory": func(t *testing.T) Frontier { return NewMemoryFrontier() },
+		"disk": func(t *testing.T) Frontier {
+			return openDisk(t, filepath.Join(t.TempDir(), "frontier.db"))
+		},
+	}
+	for name, open := range frontiers {
+		t.Run(name, func(t *testing.T) {
+			f := open(t)
+			defer f.Close()
+			for _, e := range entries {
+				if err := f.Push(e); err != nil {
+					t.Fatal(err)
+				}
+			}
+			onlyB := func(host string) bool { return host == "b" }
+			if e, _ := pop(t, f, onlyB); e.URL != "b1" {
+				t.Errorf("first eligible entry of b = %s, want b1", e.URL)
+			}
+			var got []string
+			for {
+				e, ok := pop(t, f, func(string) bool { return true })
+				if !ok {
+					break
+				}
+				got = append(got, e.URL)
+			}
+			want := []string{"a2", "a1", "a3", "b2"}
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("pop order = %v, want %v", got, want)
+			}
+			if f.Len() != 0 {
+				t.Errorf("Len() = %d after draining", f.Len())
+			}
+		})
+	}
+}
+
+func TestDiskFrontierReset(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "frontier.db")
+	f := openDisk(t, path)
+	for _, e := range frontierEntries(20) {
+		f.Push(e)
+	}
+	if err := f.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := pop(t, f, func(string) bool { return true }); ok || f.Len() != 0 {
+		t.Fatalf("frontier not empty after Reset: Len() = %d", f.Len())
+	}
+	f.Close()
+	if f = openDisk(t, path); f.Len() != 0 {
+		t.Errorf("reopened frontier has %d entries after Reset", f.Len())
+	}
+	f.Close()
+	if err := f.Push(Entry{URL: "x"}); err != errFrontierClosed {
+		t.Errorf("Push after Close = %v, want errFrontierClosed", err)
+	}
+}
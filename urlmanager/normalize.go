@@ -0,0 +1,82 @@
+package urlmanager
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"crawler/config"
+)
+
+// NormalizeURL canonicalizes raw so that trivially different spellings of
+// the same page dedupe to one visited entry. It drops
+// config.DefaultTrackingParams; UrlManager uses the configured list.
+func NormalizeURL(raw string) (string, error) {
+	return normalizeURL(raw, config.DefaultTrackingParams)
+}
+
+// normalizeURL lowercases the scheme and host, removes default ports and
+// the fragment, drops tracking query parameters, sorts the rest and strips
+// trailing slashes from the path.
+func normalizeURL(raw string, trackingParams []string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return "", fmt.Errorf("normalizing %q: %w", raw, err)
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("normalizing %q: unsupported scheme %q", raw, u.Scheme)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("normalizing %q: missing host", raw)
+	}
+
+	host, port := strings.ToLower(u.Hostname()), u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port != "" {
+		host += ":" + port
+	}
+	u.Host = host
+
+	u.Fragment, u.RawFragment = "", ""
+
+	if path := strings.TrimRight(u.EscapedPath(), "/"); path == "" {
+		u.Path, u.RawPath = "/", ""
+	} else if unescaped, err := url.PathUnescape(path); err == nil {
+		u.Path, u.RawPath = unescaped, path
+	}
+
+	if u.RawQuery != "" {
+		query := u.Query()
+		for key := range query {
+			if isTrackingParam(key, trackingParams) {
+				query.Del(key)
+			}
+		}
+		// Encode sorts by key.
+		u.RawQuery = query.Encode()
+	}
+	u.ForceQuery = false
+
+	return u.String(), nil
+}
+
+func isTrackingParam(key string, trackingParams []string) bool {
+	key = strings.ToLower(key)
+	for _, param := range trackingParams {
+		param = strings.ToLower(param)
+		if prefix, ok := strings.CutSuffix(param, "*"); ok {
+			if strings.HasPrefix(key, prefix) {
+				return true
+			}
+		} else if key == param {
+			return true
+		}
+	}
+	return false
+}
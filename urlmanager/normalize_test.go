@@ -0,0 +1,42 @@
+package urlmanager
+
+import "testing"
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"lowercases scheme and host", "HTTP://Example.COM/Path", "http://example.com/Path"},
+		{"drops default http port", "http://example.com:80/a", "http://example.com/a"},
+		{"drops default https port", "https://example.com:443/a", "https://example.com/a"},
+		{"keeps other ports", "http://example.com:8080/a", "http://example.com:8080/a"},
+		{"drops fragment", "http://example.com/a#top", "http://example.com/a"},
+		{"strips trailing slash", "http://example.com/a/", "http://example.com/a"},
+		{"keeps root slash", "http://example.com", "http://example.com/"},
+		{"sorts query", "http://example.com/?b=2&a=1", "http://example.com/?a=1&b=2"},
+		{"drops tracking params", "http://example.com/?utm_source=x&id=3&fbclid=y", "http://example.com/?id=3"},
+		{"drops empty query", "http://example.com/a?", "http://example.com/a"},
+		{"trims whitespace", "  http://example.com/a  ", "http://example.com/a"},
+		{"keeps escaped path", "http://example.com/a%2Fb/", "http://example.com/a%2Fb"},
+		{"brackets IPv6 host", "http://[::1]:80/", "http://[::1]/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeURL(tt.in)
+			if err != nil {
+				t.Fatalf("NormalizeURL(%q): %v", tt.in, err)
+			}
+			if got != tt.want {
+				t.Errorf("NormalizeURL(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeURLRejects(t *testing.T) {
+	for _, in := range []string{"ftp://example.com/", "mailto:someone@example.com", "/relative", "http://", "http://%zz/"} {
+		if got, err := NormalizeURL(in); err == nil {
+			t.Errorf("NormalizeURL(%q) = %q, want an error", in, got)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package urlmanager
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// patternFilter restricts crawling to URLs matching an include pattern and
+// none of the exclude patterns.
+type patternFilter struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+// newPatternFilter compiles include and exclude, failing on the first
+// pattern that is not a valid regular expression.
+func newPatternFilter(include, exclude []string) (*patternFilter, error) {
+	inc, err := compileAll("include", include)
+	if err != nil {
+		return nil, err
+	}
+	exc, err := compileAll("exclude", exclude)
+	if err != nil {
+		return nil, err
+	}
+	return &patternFilter{include: inc, exclude: exc}, nil
+}
+
+// allows reports whether pageURL matches at least one include pattern, or
+// there are none, and no exclude pattern. Exclusions win.
+func (f *patternFilter) allows(pageURL string) bool {
+	for _, re := range f.exclude {
+		if re.MatchString(pageURL) {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, re := range f.include {
+		if re.MatchString(pageURL) {
+			return true
+		}
+	}
+	return false
+}
+
+// compileAll compiles patterns, naming the kind of pattern in the error for
+// the first one that does not compile.
+func compileAll(kind string, patterns []string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s pattern: %w", kind, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
@@ -0,0 +1,221 @@
+package urlmanager
+
+import (
+	"container/heap"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Frontier backends accepted by ConfigManager.Frontier.
+const (
+	FrontierMemory = "memory"
+	FrontierDisk   = "disk"
+)
+
+// BreadthFirst is the default priority function: shallower URLs are
+// crawled first.
+func BreadthFirst(_ string, depth int) int {
+	return -depth
+}
+
+// Frontier holds the URLs waiting to be fetched. Every implementation hands
+// entries out in the same order: highest Priority first and, among equal
+// priorities, lowest Seq first. Implementations are safe for concurrent use.
+type Frontier interface {
+	// Push adds e, keeping its Priority and Seq.
+	Push(e Entry) error
+	// Pop removes and returns the first entry in frontier order whose host
+	// eligible returns true for. It reports false if there is none. The
+	// cost grows with the number of ineligible hosts ahead of the entry,
+	// not with the number of entries queued for them.
+	Pop(eligible func(host string) bool) (Entry, bool, error)
+	// Len returns the number of queued entries.
+	Len() int
+	// Close releases the resources held by the frontier.
+	Close() error
+}
+
+// MemoryFrontier is a Frontier kept in a heap per host, plus a heap of the
+// hosts ordered by their first entry. It is the default and is lost when
+// the process exits unless saved with UrlManager.SaveState.
+type MemoryFrontier struct {
+	mu    sync.Mutex
+	hosts map[string]*hostQueue
+	order hostHeap
+	len   int
+}
+
+// hostQueue holds the entries of one host.
+type hostQueue struct {
+	host    string
+	entries entryHeap
+	index   int // position in MemoryFrontier.order
+}
+
+// NewMemoryFrontier returns an empty MemoryFrontier.
+func NewMemoryFrontier() *MemoryFrontier {
+	return &MemoryFrontier{hosts: make(map[string]*hostQueue)}
+}
+
+func (f *MemoryFrontier) Push(e Entry) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.len++
+	q, ok := f.hosts[e.Host]
+	if !ok {
+		q = &hostQueue{host: e.Host, entries: entryHeap{e}}
+		f.hosts[e.Host] = q
+		heap.Push(&f.order, q)
+		return nil
+	}
+	heap.Push(&q.entries, e)
+	heap.Fix(&f.order, q.index)
+	return nil
+}
+
+func (f *MemoryFrontier) Pop(eligible func(host string) bool) (Entry, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var skipped []*hostQueue
+	defer func() {
+		for _, q := range skipped {
+			heap.Push(&f.order, q)
+		}
+	}()
+	for f.order.Len() > 0 {
+		q := heap.Pop(&f.order).(*hostQueue)
+		if !eligible(q.host) {
+			skipped = append(skipped, q)
+			continue
+		}
+		e := heap.Pop(&q.entries).(Entry)
+		f.len--
+		if q.entries.Len() > 0 {
+			heap.Push(&f.order, q)
+		} else {
+			delete(f.hosts, q.host)
+		}
+		return e, true, nil
+	}
+	return Entry{}, false, nil
+}
+
+func (f *MemoryFrontier) Len() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.len
+}
+
+func (f *MemoryFrontier) Close() error { return nil }
+
+// Entries returns a copy of the queued entries in frontier order.
+func (f *MemoryFrontier) Entries() []Entry {
+	f.mu.Lock()
+	entries := make(entryHeap, 0, f.len)
+	for _, q := range f.hosts {
+		entries = append(entries, q.entries...)
+	}
+	f.mu.Unlock()
+	sort.Sort(entries)
+	return entries
+}
+
+// Reset empties the frontier.
+func (f *MemoryFrontier) Reset() {
+	f.mu.Lock()
+	f.hosts = make(map[string]*hostQueue)
+	f.order = f.order[:0]
+	f.len = 0
+	f.mu.Unlock()
+}
+
+// before reports whether a comes ahead of b in frontier order.
+func before(a, b Entry) bool {
+	if a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
+	return a.Seq < b.Seq
+}
+
+// entryHeap implements heap.Interface in frontier order.
+type entryHeap []Entry
+
+func (h entryHeap) Len() int { return len(h) }
+
+func (h entryHeap) Less(i, j int) bool { return before(h[i], h[j]) }
+
+func (h entryHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *entryHeap) Push(x any) { *h = append(*h, x.(Entry)) }
+
+func (h *entryHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// hostHeap implements heap.Interface over host queues, ordered by their
+// first entry.
+type hostHeap []*hostQueue
+
+func (h hostHeap) Len() int { return len(h) }
+
+func (h hostHeap) Less(i, j int) bool { return before(h[i].entries[0], h[j].entries[0]) }
+
+func (h hostHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *hostHeap) Push(x any) {
+	q := x.(*hostQueue)
+	q.index = len(*h)
+	*h = append(*h, q)
+}
+
+func (h *hostHeap) Pop() any {
+	old := *h
+	q := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return q
+}
+
+// enqueue assigns item its priority and position and pushes it onto the
+// queue. It reports false, after logging why, if the frontier rejected it.
+// Callers must hold um.mu.
+func (um *UrlManager) enqueue(item Entry) bool {
+	item.Priority = um.priority(item.URL, item.Depth)
+	item.Seq = um.seq
+	um.seq++
+	if err := um.queue.Push(item); err != nil {
+		um.log.Error("queueing URL failed", "url", item.URL, "error", err)
+		return false
+	}
+	return true
+}
+
+// popEligible removes and returns the highest-priority queued URL whose host
+// is below maxPerHost and not held back by the circuit breaker. A frontier
+// that cannot be read is logged and shuts the manager down. Callers must
+// hold um.mu.
+func (um *UrlManager) popEligible() (Entry, bool) {
+	now := time.Now()
+	item, ok, err := um.queue.Pop(func(host string) bool {
+		if um.maxPerHost > 0 && um.hostInFlight[host] >= um.maxPerHost {
+			return false
+		}
+		return um.breaker == nil || um.breaker.allows(host, now)
+	})
+	if err != nil {
+		um.log.Error("reading frontier failed, stopping crawl", "error", err)
+		um.done = true
+		return Entry{}, false
+	}
+	if ok && um.breaker != nil {
+		um.breaker.dispatched(item)
+	}
+	return item, ok
+}
@@ -0,0 +1,183 @@
+package urlmanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// crawlState is the on-disk form of the frontier.
+type crawlState struct {
+	Queue   []stateEntry `json:"queue"`
+	Visited []string     `json:"visited"`
+	// Bloom holds the visited set instead of Visited when it is a bloom
+	// filter.
+	Bloom []byte `json:"bloom,omitempty"`
+	// Content maps content hashes to the URL they were stored under.
+	Content map[string]string `json:"content,omitempty"`
+	// Canonical maps canonical URLs to the URL stored for them.
+	Canonical map[string]string `json:"canonical,omitempty"`
+	// DiskFrontier is set when the queue lives in a disk frontier; Queue
+	// then only holds the URLs that were in flight.
+	DiskFrontier bool   `json:"disk_frontier,omitempty"`
+	Seq          uint64 `json:"seq,omitempty"`
+}
+
+type stateEntry struct {
+	URL   string `json:"url"`
+	Depth int    `json:"depth"`
+}
+
+// SaveState writes the queue and visited set to path, in crawl order. URLs
+// that are being fetched are saved as queued so they are retried on resume.
+// A disk frontier is synced instead of copied into the file.
+func (um *UrlManager) SaveState(path string) error {
+	um.mu.Lock()
+	state := crawlState{Queue: make([]stateEntry, 0, len(um.active)), Seq: um.seq}
+	for _, item := range um.active {
+		state.Queue = append(state.Queue, stateEntry{URL: item.URL, Depth: item.Depth})
+	}
+	var disk *DiskFrontier
+	switch queue := um.queue.(type) {
+	case *MemoryFrontier:
+		for _, item := range queue.Entries() {
+			state.Queue = append(state.Queue, stateEntry{URL: item.URL, Depth: item.Depth})
+		}
+	case *DiskFrontier:
+		disk = queue
+		state.DiskFrontier = true
+	}
+	switch visited := um.visited.(type) {
+	case MapSet:
+		state.Visited = make([]string, 0, len(visited))
+		for pageURL := range visited {
+			state.Visited = append(state.Visited, pageURL)
+		}
+	case *BloomFilter:
+		// Encoding a filter cannot fail.
+		state.Bloom, _ = visited.MarshalBinary()
+	}
+	state.Content = make(map[string]string, len(um.contentOwners))
+	for hash, owner := range um.contentOwners {
+		state.Content[hash] = owner
+	}
+	state.Canonical = make(map[string]string, len(um.canonicalOwners))
+	for canonical, owner := range um.canonicalOwners {
+		state.Canonical[canonical] = owner
+	}
+	um.mu.Unlock()
+
+	if disk != nil {
+		if err := disk.Sync(); err != nil {
+			return fmt.Errorf("saving crawl state: %w", err)
+		}
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("encoding crawl state: %w", err)
+	}
+
+	// Write to a temporary file first so a crash mid-write never leaves a
+	// truncated state file behind.
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("saving crawl state: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("saving crawl state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("saving crawl state: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("saving crawl state: %w", err)
+	}
+	return nil
+}
+
+// LoadState replaces the queue and visited set with the contents of path.
+// A disk frontier keeps its entries and gets back the URLs that were in
+// flight. It must be called before RunWorkers. On error the manager is
+// unchanged; a missing file yields an error satisfying
+// errors.Is(err, os.ErrNotExist).
+func (um *UrlManager) LoadState(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var state crawlState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("decoding crawl state %s: %w", path, err)
+	}
+	memory, isMemory := um.queue.(*MemoryFrontier)
+	if state.DiskFrontier == isMemory {
+		return fmt.Errorf("decoding crawl state %s: saved with a different frontier backend", path)
+	}
+
+	visited := um.newVisited()
+	if state.Bloom != nil {
+		bloom, ok := visited.(*BloomFilter)
+		if !ok {
+			return fmt.Errorf("decoding crawl state %s: saved with a bloom filter visited set", path)
+		}
+		if err := bloom.UnmarshalBinary(state.Bloom); err != nil {
+			return fmt.Errorf("decoding crawl state %s: %w", path, err)
+		}
+	}
+	for _, pageURL := range state.Visited {
+		visited.Add(pageURL)
+	}
+	for _, entry := range state.Queue {
+		if entry.URL == "" || entry.Depth < 0 {
+			return fmt.Errorf("decoding crawl state %s: invalid queue entry %+v", path, entry)
+		}
+		visited.Add(entry.URL)
+	}
+
+	content := make(map[string]string, len(state.Content))
+	for hash, owner := range state.Content {
+		content[hash] = owner
+	}
+	canonical := make(map[string]string, len(state.Canonical))
+	for key, owner := range state.Canonical {
+		canonical[key] = owner
+	}
+
+	um.mu.Lock()
+	if isMemory {
+		memory.Reset()
+	}
+	um.seq = max(um.seq, state.Seq)
+	for _, entry := range state.Queue {
+		um.enqueue(Entry{URL: entry.URL, Host: hostOf(entry.URL), Depth: entry.Depth})
+	}
+	um.visited = visited
+	um.contentOwners = content
+	um.canonicalOwners = canonical
+	um.reportGauges()
+	um.mu.Unlock()
+	return nil
+}
+
+// Checkpoint saves the state to path every interval until the crawl ends.
+// Failures are logged, not fatal.
+func (um *UrlManager) Checkpoint(path string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := um.SaveState(path); err != nil {
+				um.log.Error("checkpoint failed", "error", err)
+			}
+		case <-um.finished:
+			return
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package urlmanager
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// queuedURLs returns the URLs queued in um's memory frontier, in crawl
+// order.
+func queuedURLs(um *UrlManager) []string {
+	var urls []string
+	for _, e := range um.queue.(*MemoryFrontier).Entries() {
+		urls = append(urls, e.URL)
+	}
+	return urls
+}
+
+func TestStateRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	saved := newTestManager(t, testConfig())
+	for _, u := range []string{"http://example.com/", "http://example.com/a", "http://example.com/b"} {
+		saved.Add(ctx, u, 1)
+	}
+	saved.Add(ctx, "http://example.com/deep", 2)
+	saved.ClaimContent("hash", "http://example.com/")
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := saved.SaveState(path); err != nil {
+		t.Fatalf("SaveState: %v", err)
+	}
+
+	loaded := newTestManager(t, testConfig())
+	if err := loaded.LoadState(path); err != nil {
+		t.Fatalf("LoadState: %v", err)
+	}
+	if got, want := strings.Join(queuedURLs(loaded), " "), strings.Join(queuedURLs(saved), " "); got != want {
+		t.Errorf("queue after loading = %s, want %s", got, want)
+	}
+	if loaded.VisitedLen() != saved.VisitedLen() {
+		t.Errorf("visited %d URLs after loading, want %d", loaded.VisitedLen(), saved.VisitedLen())
+	}
+	if loaded.Add(ctx, "http://example.com/a", 1) {
+		t.Error("a saved URL was enqueued again")
+	}
+	if owner, ok := loaded.ClaimContent("hash", "http://example.com/a"); ok || owner != "http://example.com/" {
+		t.Errorf("ClaimContent after loading = %q, %v; want the saved owner", owner, ok)
+	}
+}
+
+func TestLoadStateMissingFile(t *testing.T) {
+	um := newTestManager(t, testConfig())
+	err := um.LoadState(filepath.Join(t.TempDir(), "missing.json"))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("LoadState error = %v, want os.ErrNotExist", err)
+	}
+}
+
+func TestLoadStateCorruptFileLeavesManagerUnchanged(t *testing.T) {
+	corrupt := map[string]string{
+		"truncated":     `{"queue": [{"url": "http://example.com/x", "depth": 1}`,
+		"not JSON":      "queue: []",
+		"invalid entry": `{"queue": [{"url": "http://example.com/x", "depth": 1}, {"url": "", "depth": 0}], "visited": ["http://example.com/y"]}`,
+	}
+	for name, content := range corrupt {
+		t.Run(name, func(t *testing.T) {
+			um := newTestManager(t, testConfig())
+			um.Add(context.Background(), "http://example.com/", 0)
+			path := filepath.Join(t.TempDir(), "state.json")
+			if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if err := um.LoadState(path); err == nil {
+				t.Fatal("LoadState accepted a corrupt file")
+			}
+			if got := strings.Join(queuedURLs(um), " "); got != "http://example.com/" {
+				t.Errorf("queue after a failed load = %s, want the original URL", got)
+			}
+			if n := um.VisitedLen(); n != 1 {
+				t.Errorf("visited %d URLs after a failed load, want 1", n)
+			}
+		})
+	}
+}
+
+func TestSaveStateReplacesFileAtomically(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	um := newTestManager(t, testConfig())
+	um.Add(context.Background(), "http://example.com/", 0)
+	if err := um.SaveState(path); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A reader holding the old file keeps seeing all of it: the new state
+	// is renamed over the path rather than written into the file in place.
+	old, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer old.Close()
+	um.Add(context.Background(), "http://example.com/a", 1)
+	if err := um.SaveState(path); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := io.ReadAll(old); err != nil || string(got) != string(before) {
+		t.Errorf("old state file changed under its reader: %q, %v", got, err)
+	}
+	loaded := newTestManager(t, testConfig())
+	if err := loaded.LoadState(path); err != nil {
+		t.Fatal(err)
+	}
+	if n := loaded.QueueLen(); n != 2 {
+		t.Errorf("new state file holds %d queued URLs, want 2", n)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		t.Errorf("directory holds %v, want only the state file", names)
+	}
+}
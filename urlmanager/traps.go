@@ -0,0 +1,51 @@
+package urlmanager
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"crawler/common"
+)
+
+// trapFilter rejects URLs that look like crawler traps: generated link
+// spaces such as calendars or relative links that nest /a/a/a/... forever.
+type trapFilter struct {
+	maxLength   int
+	maxSegments int
+	maxRepeats  int
+}
+
+// newTrapFilter applies the trap thresholds of cfg. A zero threshold
+// disables that check.
+func newTrapFilter(cfg *common.ConfigManager) *trapFilter {
+	return &trapFilter{
+		maxLength:   int(cfg.MaxURLLength),
+		maxSegments: int(cfg.MaxPathSegments),
+		maxRepeats:  int(cfg.MaxSegmentRepeats),
+	}
+}
+
+// check returns why rawURL looks like a trap, or "" if it doesn't.
+func (f *trapFilter) check(rawURL string) string {
+	if f.maxLength > 0 && len(rawURL) > f.maxLength {
+		return fmt.Sprintf("URL longer than %d bytes", f.maxLength)
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	segments := strings.FieldsFunc(u.Path, func(r rune) bool { return r == '/' })
+	if f.maxSegments > 0 && len(segments) > f.maxSegments {
+		return fmt.Sprintf("path deeper than %d segments", f.maxSegments)
+	}
+	if f.maxRepeats > 0 {
+		counts := make(map[string]int, len(segments))
+		for _, s := range segments {
+			if counts[s]++; counts[s] > f.maxRepeats {
+				return fmt.Sprintf("path segment %q repeated more than %d times", s, f.maxRepeats)
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,639 @@
+package urlmanager
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"crawler/common"
+	"crawler/metrics"
+)
+
+// UrlManager owns the crawl frontier: it deduplicates URLs, hands them out
+// to workers over urlChannel and detects when the crawl has run dry.
+type UrlManager struct {
+	mu              sync.Mutex
+	cond            *sync.Cond
+	queue           Frontier
+	seq             uint64
+	priority        func(url string, depth int) int
+	onEnqueue       func(Entry)
+	visited         VisitedSet
+	newVisited      func() VisitedSet
+	urlChannel      chan Entry
+	activeWorkers   sync.WaitGroup
+	shutDownChannel chan struct{}
+	shutDownOnce    sync.Once
+	finished        chan struct{}
+	done            bool
+	paused          bool
+	inFlight        int
+	active          map[string]Entry
+	contentOwners   map[string]string
+	canonicalOwners map[string]string
+	hostInFlight    map[string]int
+	hostDelay       map[string]time.Duration
+	adaptive        *adaptiveDelay
+	breaker         *circuitBreaker
+	maxPerHost      int
+	maxDepth        int
+	maxPages        int
+	reservedPages   int
+	storedPages     int
+	trackingParams  []string
+	domains         *domainFilter
+	traps           *trapFilter
+	patterns        *patternFilter
+	robots          *common.RobotsManager
+	log             *slog.Logger
+	disallowed      int
+	rejected        int
+	trapped         int
+	reported        gauges
+}
+
+// gauges holds the values a manager last added to the shared gauges, which
+// sum them over all jobs.
+type gauges struct {
+	queued, visited, inFlight int
+}
+
+// Entry is a frontier entry. Seeds have depth 0 and links found on a
+// page at depth N have depth N+1. Seq orders entries of equal priority.
+type Entry struct {
+	URL      string `json:"url"`
+	Host     string `json:"host"`
+	Depth    int    `json:"depth"`
+	Priority int    `json:"priority"`
+	Seq      uint64 `json:"seq"`
+}
+
+// NewUrlManager creates a manager configured by cfg that consults robots
+// before enqueuing. A nil robots skips robots.txt checks entirely. With
+// cfg.Frontier set to FrontierDisk the queue is kept in cfg.FrontierPath; if
+// that file cannot be opened the error is logged and the queue is kept in
+// memory. Close releases the file. An include or exclude pattern that does
+// not compile is returned as an error.
+func NewUrlManager(cfg *common.ConfigManager, robots *common.RobotsManager) (*UrlManager, error) {
+	patterns, err := newPatternFilter(cfg.IncludePatterns, cfg.ExcludePatterns)
+	if err != nil {
+		return nil, err
+	}
+	um := &UrlManager{
+		urlChannel:      make(chan Entry),
+		shutDownChannel: make(chan struct{}),
+		finished:        make(chan struct{}),
+		active:          make(map[string]Entry),
+		contentOwners:   make(map[string]string),
+		canonicalOwners: make(map[string]string),
+		hostInFlight:    make(map[string]int),
+		hostDelay:       make(map[string]time.Duration),
+		maxPerHost:      int(cfg.MaxPerHost),
+		maxDepth:        int(cfg.MaxDepth),
+		maxPages:        int(cfg.MaxPages),
+		trackingParams:  cfg.TrackingParams,
+		domains:         newDomainFilter(cfg.AllowedDomains, cfg.SeedUrls, cfg.AllowSubdomains),
+		traps:           newTrapFilter(cfg),
+		patterns:        patterns,
+		robots:          robots,
+		log:             cfg.Log(),
+	}
+	um.newVisited = func() VisitedSet { return NewMapSet() }
+	if cfg.VisitedSet == VisitedBloom {
+		um.newVisited = func() VisitedSet {
+			return NewBloomFilter(int(cfg.BloomExpectedURLs), cfg.BloomFPRate)
+		}
+	}
+	um.visited = um.newVisited()
+	um.queue = NewMemoryFrontier()
+	if cfg.Frontier == FrontierDisk {
+		if disk, err := OpenDiskFrontier(cfg.FrontierPath); err != nil {
+			um.log.Error("opening disk frontier failed, queueing in memory", "error", err)
+		} else {
+			um.queue = disk
+		}
+	}
+	if cfg.AdaptiveDelay {
+		um.adaptive = &adaptiveDelay{min: cfg.MinDelay, max: cfg.MaxDelay, factor: cfg.DelayFactor}
+	}
+	if cfg.BreakerThreshold > 0 {
+		um.breaker = newCircuitBreaker(int(cfg.BreakerThreshold), cfg.BreakerCooldown)
+	}
+	if um.priority = cfg.Priority; um.priority == nil {
+		um.priority = BreadthFirst
+	}
+	um.cond = sync.NewCond(&um.mu)
+	return um, nil
+}
+
+// Add normalizes pageURL and enqueues it at the given depth unless it is
+// invalid, too deep, outside the allowed domains, filtered out by the
+// include/exclude patterns, a likely crawler trap, already seen or
+// disallowed by robots.txt. It reports whether the URL was enqueued. URLs
+// added after Shutdown are kept so SaveState records them. ctx bounds the
+// robots.txt fetch.
+func (um *UrlManager) Add(ctx context.Context, pageURL string, depth int) bool {
+	if um.maxDepth > 0 && depth > um.maxDepth {
+		return false
+	}
+	pageURL, err := normalizeURL(pageURL, um.trackingParams)
+	if err != nil {
+		um.log.Debug("dropping invalid URL", "error", err)
+		return false
+	}
+	if reason := um.filter(pageURL); reason != "" {
+		um.log.Debug("dropping URL", "url", pageURL, "reason", reason)
+		return false
+	}
+
+	um.mu.Lock()
+	if um.visited.Contains(pageURL) {
+		um.mu.Unlock()
+		return false
+	}
+	um.mu.Unlock()
+
+	if reason := um.checkRobots(ctx, pageURL); reason != "" {
+		um.log.Debug("dropping URL", "url", pageURL, "reason", reason)
+		return false
+	}
+
+	um.mu.Lock()
+	if um.visited.Contains(pageURL) {
+		um.mu.Unlock()
+		return false
+	}
+	um.visited.Add(pageURL)
+	entry := Entry{URL: pageURL, Host: hostOf(pageURL), Depth: depth}
+	if !um.enqueue(entry) {
+		um.mu.Unlock()
+		return false
+	}
+	metrics.URLsDiscovered.Inc()
+	um.reportGauges()
+	um.cond.Broadcast()
+	onEnqueue := um.onEnqueue
+	um.mu.Unlock()
+	um.log.Debug("url enqueued", "url", pageURL, "depth", depth)
+	if onEnqueue != nil {
+		onEnqueue(entry)
+	}
+	return true
+}
+
+// OnEnqueue sets fn to be called, without the manager's lock held, with
+// every entry Add enqueues. It must be set before the first Add.
+func (um *UrlManager) OnEnqueue(fn func(Entry)) {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+	um.onEnqueue = fn
+}
+
+// filter returns why pageURL, already normalized, must not be crawled
+// because of the domain filter, the include/exclude patterns or the trap
+// rules, or "" if it may be. Rejected URLs are counted.
+func (um *UrlManager) filter(pageURL string) string {
+	if !um.domains.allows(hostOf(pageURL)) {
+		um.mu.Lock()
+		um.rejected++
+		um.mu.Unlock()
+		return "outside allowed domains"
+	}
+	if !um.patterns.allows(pageURL) {
+		um.mu.Lock()
+		um.rejected++
+		um.mu.Unlock()
+		return "filtered by include/exclude patterns"
+	}
+	if reason := um.traps.check(pageURL); reason != "" {
+		um.mu.Lock()
+		um.trapped++
+		um.mu.Unlock()
+		return "likely crawler trap: " + reason
+	}
+	return ""
+}
+
+// checkRobots returns why robots.txt disallows pageURL, or "" if it allows
+// it. Disallowed URLs are marked visited, so each is counted once however
+// often it is linked. It is called without um.mu held since it may fetch
+// robots.txt.
+func (um *UrlManager) checkRobots(ctx context.Context, pageURL string) string {
+	if um.robots == nil || um.robots.IsAllowed(ctx, pageURL) {
+		return ""
+	}
+	um.mu.Lock()
+	if !um.visited.Contains(pageURL) {
+		um.visited.Add(pageURL)
+		um.disallowed++
+		um.reportGauges()
+	}
+	um.mu.Unlock()
+	return "disallowed by robots.txt"
+}
+
+// MarkRedirect records that from, a URL handed out by the manager or an
+// earlier hop of its redirect chain, redirected to to. It returns why the redirected page must not be stored:
+// to is outside the allowed domains, filtered out, a likely trap or
+// disallowed by robots.txt, just like a URL rejected by Add, or already
+// seen under another URL, in which case the page is a duplicate. Otherwise
+// it marks to as visited so it is not crawled again and returns "".
+func (um *UrlManager) MarkRedirect(ctx context.Context, from, to string) string {
+	to, err := normalizeURL(to, um.trackingParams)
+	if err != nil {
+		return "invalid URL"
+	}
+	if to == from {
+		return ""
+	}
+	if reason := um.filter(to); reason != "" {
+		return reason
+	}
+	if reason := um.checkRobots(ctx, to); reason != "" {
+		return reason
+	}
+	um.mu.Lock()
+	defer um.mu.Unlock()
+	if um.visited.Contains(to) {
+		return "already seen"
+	}
+	um.visited.Add(to)
+	um.reportGauges()
+	return ""
+}
+
+// ClaimContent records pageURL as the owner of the content with the given
+// hash. If another URL already owns it, that URL is returned with false.
+func (um *UrlManager) ClaimContent(hash, pageURL string) (string, bool) {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+	if owner, ok := um.contentOwners[hash]; ok && owner != pageURL {
+		return owner, false
+	}
+	um.contentOwners[hash] = pageURL
+	return pageURL, true
+}
+
+// ClaimCanonical claims for pageURL the identity its page is stored under:
+// canonical, the URL it declares with <link rel="canonical">, normalized,
+// or pageURL itself when it declares none or one outside the allowed
+// domains. It returns that URL, and false if another page already claimed
+// it, such as a variant of the canonical page fetched first.
+func (um *UrlManager) ClaimCanonical(canonical, pageURL string) (string, bool) {
+	key := um.canonicalKey(canonical, pageURL)
+	um.mu.Lock()
+	defer um.mu.Unlock()
+	if owner, ok := um.canonicalOwners[key]; ok && owner != pageURL {
+		return key, false
+	}
+	um.canonicalOwners[key] = pageURL
+	return key, true
+}
+
+// ReleaseCanonical undoes a ClaimCanonical by pageURL.
+func (um *UrlManager) ReleaseCanonical(canonical, pageURL string) {
+	key := um.canonicalKey(canonical, pageURL)
+	um.mu.Lock()
+	defer um.mu.Unlock()
+	if um.canonicalOwners[key] == pageURL {
+		delete(um.canonicalOwners, key)
+	}
+}
+
+func (um *UrlManager) canonicalKey(canonical, pageURL string) string {
+	if canonical != "" {
+		if normalized, err := normalizeURL(canonical, um.trackingParams); err == nil && um.domains.allows(hostOf(normalized)) {
+			return normalized
+		}
+	}
+	if normalized, err := normalizeURL(pageURL, um.trackingParams); err == nil {
+		return normalized
+	}
+	return pageURL
+}
+
+// ReleaseContent forgets the owner of hash, e.g. after storing it failed.
+func (um *UrlManager) ReleaseContent(hash string) {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+	delete(um.contentOwners, hash)
+}
+
+// ReservePage claims one of the cfg.MaxPages pages the crawl may store. It
+// reports false once every page is claimed, in which case the page must not
+// be stored. A successful claim is settled with PageStored or ReleasePage,
+// so concurrent workers never store more than the limit between them.
+func (um *UrlManager) ReservePage() bool {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+	if um.maxPages > 0 && um.reservedPages >= um.maxPages {
+		return false
+	}
+	um.reservedPages++
+	return true
+}
+
+// ReleasePage returns a page claimed with ReservePage that was not stored.
+func (um *UrlManager) ReleasePage() {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+	um.reservedPages--
+}
+
+// PageStored records that a page claimed with ReservePage was stored. The
+// manager shuts down once cfg.MaxPages pages have been.
+func (um *UrlManager) PageStored() {
+	um.mu.Lock()
+	um.storedPages++
+	limitReached := um.maxPages > 0 && um.storedPages >= um.maxPages
+	um.mu.Unlock()
+	if limitReached {
+		um.log.Info("page limit reached, shutting down", "max_pages", um.maxPages)
+		um.Shutdown()
+	}
+}
+
+// Disallowed returns how many URLs were dropped because of robots.txt.
+func (um *UrlManager) Disallowed() int {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+	return um.disallowed
+}
+
+// Rejected returns how many URLs were dropped by the domain filter or the
+// include/exclude patterns.
+func (um *UrlManager) Rejected() int {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+	return um.rejected
+}
+
+// Trapped returns how many URLs were dropped as likely crawler traps.
+func (um *UrlManager) Trapped() int {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+	return um.trapped
+}
+
+// QueueLen returns the number of URLs waiting to be fetched.
+func (um *UrlManager) QueueLen() int {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+	return um.queue.Len()
+}
+
+// ClearQueue drops every queued URL, such as those a disk frontier kept from
+// an earlier crawl that is not being resumed. It must be called before
+// RunWorkers.
+func (um *UrlManager) ClearQueue() error {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+	switch queue := um.queue.(type) {
+	case *MemoryFrontier:
+		queue.Reset()
+	case *DiskFrontier:
+		if err := queue.Reset(); err != nil {
+			return err
+		}
+	}
+	um.reportGauges()
+	return nil
+}
+
+// Close releases the frontier. The manager must not be used afterwards.
+func (um *UrlManager) Close() error {
+	return um.queue.Close()
+}
+
+// VisitedLen returns the number of URLs seen so far, queued or fetched.
+func (um *UrlManager) VisitedLen() int {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+	return um.visited.Len()
+}
+
+// ActiveLen returns how many URLs are being processed by workers.
+func (um *UrlManager) ActiveLen() int {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+	return um.inFlight
+}
+
+// InFlight returns how many URLs of host are currently being processed.
+func (um *UrlManager) InFlight(host string) int {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+	return um.hostInFlight[strings.ToLower(host)]
+}
+
+// RunWorkers starts n workers that call fetch for every URL handed out,
+// along with the depth it was found at. It returns immediately; use Wait to
+// block until the crawl is over. Cancelling ctx shuts the manager down and
+// is passed on to fetch so in-flight work can be aborted; URLs whose fetch
+// returns after that are put back in the queue.
+func (um *UrlManager) RunWorkers(ctx context.Context, n int, fetch func(ctx context.Context, pageURL string, depth int)) {
+	go func() {
+		select {
+		case <-ctx.Done():
+			um.Shutdown()
+		case <-um.finished:
+		}
+	}()
+	go um.dispatch(ctx)
+	for i := 0; i < n; i++ {
+		um.activeWorkers.Add(1)
+		go func() {
+			defer um.activeWorkers.Done()
+			for item := range um.urlChannel {
+				if um.heldBack(item) {
+					um.requeue(item)
+					continue
+				}
+				fetch(ctx, item.URL, item.Depth)
+				if ctx.Err() != nil {
+					// The fetch was cut short; keep the URL for a
+					// resumed crawl.
+					um.requeue(item)
+					continue
+				}
+				um.markDone(item)
+			}
+		}()
+	}
+}
+
+// Wait blocks until every worker has exited.
+func (um *UrlManager) Wait() {
+	um.activeWorkers.Wait()
+}
+
+// Done returns a channel that is closed once no more URLs will be handed
+// out: the queue is empty and no URL is in flight, or the manager was shut
+// down. Workers may still be finishing their last URL; Wait covers that.
+func (um *UrlManager) Done() <-chan struct{} {
+	return um.finished
+}
+
+// Pause stops handing out URLs until Resume. Workers finish their current
+// URL and then wait.
+func (um *UrlManager) Pause() {
+	um.setPaused(true)
+}
+
+// Resume undoes Pause.
+func (um *UrlManager) Resume() {
+	um.setPaused(false)
+}
+
+// Paused reports whether the manager is paused.
+func (um *UrlManager) Paused() bool {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+	return um.paused
+}
+
+func (um *UrlManager) setPaused(paused bool) {
+	um.mu.Lock()
+	um.paused = paused
+	um.cond.Broadcast()
+	um.mu.Unlock()
+}
+
+// Shutdown stops handing out URLs. Workers finish their current URL and exit.
+func (um *UrlManager) Shutdown() {
+	um.shutDownOnce.Do(func() {
+		um.mu.Lock()
+		um.done = true
+		close(um.shutDownChannel)
+		um.cond.Broadcast()
+		um.mu.Unlock()
+	})
+}
+
+// dispatch feeds queued URLs to workers, highest priority first, until the
+// queue is empty and no URL is being processed, or until Shutdown is called
+// or ctx is cancelled. URLs whose host is at its concurrency limit are
+// skipped in favour of the next eligible one.
+//
+// While paused no URLs are handed out, but in-flight ones run to
+// completion. An empty queue alone does not end the crawl: a URL counts as
+// in flight from the moment it is dequeued until its worker returns from
+// fetch, so links the worker adds are always queued before inFlight drops
+// to zero.
+func (um *UrlManager) dispatch(ctx context.Context) {
+	defer close(um.finished)
+	defer close(um.urlChannel)
+	for {
+		um.mu.Lock()
+		var item Entry
+		var ok bool
+		for !um.done {
+			if !um.paused {
+				if item, ok = um.popEligible(); ok {
+					break
+				}
+			}
+			if um.inFlight == 0 && um.queue.Len() == 0 {
+				break
+			}
+			um.cond.Wait()
+		}
+		if um.done || !ok {
+			if ok {
+				um.push(item)
+			}
+			um.done = true
+			um.mu.Unlock()
+			return
+		}
+		um.inFlight++
+		um.active[item.URL] = item
+		um.hostInFlight[item.Host]++
+		um.reportGauges()
+		um.mu.Unlock()
+
+		select {
+		case um.urlChannel <- item:
+		case <-um.shutDownChannel:
+			um.requeue(item)
+			return
+		case <-ctx.Done():
+			um.requeue(item)
+			return
+		}
+	}
+}
+
+// heldBack reports whether the manager was paused, or the circuit breaker
+// opened for item's host, between the item being dequeued and reaching a
+// worker.
+func (um *UrlManager) heldBack(item Entry) bool {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+	return um.paused || (um.breaker != nil && um.breaker.holds(item))
+}
+
+// requeue puts back an item that was taken off the queue but never handed
+// to a worker, so a final SaveState still records it. It keeps its place
+// ahead of URLs added later.
+func (um *UrlManager) requeue(item Entry) {
+	um.mu.Lock()
+	um.push(item)
+	um.reportGauges()
+	um.release(item)
+	um.mu.Unlock()
+}
+
+// push returns item to the queue unchanged, logging any failure. Callers
+// must hold um.mu.
+func (um *UrlManager) push(item Entry) {
+	if err := um.queue.Push(item); err != nil {
+		um.log.Error("requeueing URL failed", "url", item.URL, "error", err)
+	}
+}
+
+// markDone releases the bookkeeping for item. Workers call it whether or not
+// the fetch succeeded, and only after fetch has returned.
+func (um *UrlManager) markDone(item Entry) {
+	um.mu.Lock()
+	um.release(item)
+	um.mu.Unlock()
+}
+
+// release drops item from the in-flight bookkeeping and wakes the
+// dispatcher. Callers must hold um.mu.
+func (um *UrlManager) release(item Entry) {
+	um.inFlight--
+	delete(um.active, item.URL)
+	if um.hostInFlight[item.Host]--; um.hostInFlight[item.Host] <= 0 {
+		delete(um.hostInFlight, item.Host)
+	}
+	if um.breaker != nil {
+		um.breaker.done(item)
+	}
+	um.reportGauges()
+	um.cond.Broadcast()
+}
+
+// reportGauges brings the queue, visited and in-flight gauges up to date
+// with this manager's counts. It adds the change since the last report
+// rather than setting them, so the gauges total every job. Callers must
+// hold um.mu.
+func (um *UrlManager) reportGauges() {
+	now := gauges{queued: um.queue.Len(), visited: um.visited.Len(), inFlight: um.inFlight}
+	metrics.QueueLength.Add(float64(now.queued - um.reported.queued))
+	metrics.VisitedSize.Add(float64(now.visited - um.reported.visited))
+	metrics.InFlightWorkers.Add(float64(now.inFlight - um.reported.inFlight))
+	um.reported = now
+}
+
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Host)
+}
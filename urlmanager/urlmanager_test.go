@@ -0,0 +1,363 @@
+package urlmanager
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"crawler/common"
+	"crawler/config"
+)
+
+// testConfig returns the default configuration for a crawl seeded with
+// http://example.com/, with logging discarded.
+func testConfig() *common.ConfigManager {
+	cfg := config.DefaultConfig()
+	cfg.SeedUrls = []string{"http://example.com/"}
+	cfg.Logger = slog.New(slog.DiscardHandler)
+	return cfg
+}
+
+// newTestManager returns a manager for cfg that skips robots.txt.
+func newTestManager(t *testing.T, cfg *common.ConfigManager) *UrlManager {
+	t.Helper()
+	um, err := NewUrlManager(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewUrlManager: %v", err)
+	}
+	t.Cleanup(func() { um.Close() })
+	return um
+}
+
+// crawlSite runs workers over um as if crawling a site whose pages link to
+// the paths listed in links, and returns the paths handed out.
+func crawlSite(um *UrlManager, links map[string][]string) []string {
+	var mu sync.Mutex
+	var fetched []string
+	um.RunWorkers(context.Background(), 2, func(ctx context.Context, pageURL string, depth int) {
+		path := strings.TrimPrefix(pageURL, "http://example.com")
+		mu.Lock()
+		fetched = append(fetched, path)
+		mu.Unlock()
+		for _, link := range links[path] {
+			um.Add(ctx, "http://example.com"+link, depth+1)
+		}
+	})
+	um.Wait()
+	return fetched
+}
+
+func TestMaxDepth(t *testing.T) {
+	um := newTestManager(t, &common.ConfigManager{MaxDepth: 1})
+	um.Add(context.Background(), "http://example.com/", 0)
+	fetched := crawlSite(um, map[string][]string{
+		"/":  {"/1"},
+		"/1": {"/2"},
+		"/2": {"/3"},
+	})
+	if strings.Join(fetched, " ") != "/ /1" {
+		t.Errorf("fetched %v, want / and /1 only", fetched)
+	}
+}
+
+func TestExternalLinksNotEnqueued(t *testing.T) {
+	um := newTestManager(t, &common.ConfigManager{SeedUrls: []string{"http://example.com/"}})
+	if !um.Add(context.Background(), "http://example.com/", 0) {
+		t.Fatal("seed not enqueued")
+	}
+	if um.Add(context.Background(), "http://other.example.org/", 1) {
+		t.Error("external URL enqueued")
+	}
+	if um.Add(context.Background(), "http://sub.example.com/", 1) {
+		t.Error("subdomain enqueued without AllowSubdomains")
+	}
+	if got := um.Rejected(); got != 2 {
+		t.Errorf("Rejected() = %d, want 2", got)
+	}
+}
+
+func TestAllowSubdomains(t *testing.T) {
+	um := newTestManager(t, &common.ConfigManager{
+		AllowedDomains:  []string{"example.com"},
+		AllowSubdomains: true,
+	})
+	if !um.Add(context.Background(), "http://sub.example.com/", 0) {
+		t.Error("subdomain rejected with AllowSubdomains")
+	}
+	if um.Add(context.Background(), "http://notexample.com/", 0) {
+		t.Error("lookalike domain enqueued")
+	}
+}
+
+func TestCancelStopsWorkersAndRequeues(t *testing.T) {
+	um := newTestManager(t, &common.ConfigManager{})
+	um.Add(context.Background(), "http://example.com/", 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	um.RunWorkers(ctx, 2, func(ctx context.Context, pageURL string, depth int) {
+		cancel()
+		<-ctx.Done()
+	})
+	done := make(chan struct{})
+	go func() {
+		um.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("workers still running after ctx was cancelled")
+	}
+	// The page whose fetch was cancelled is kept for a resumed crawl.
+	if n := um.QueueLen(); n != 1 {
+		t.Errorf("QueueLen() = %d after cancelling, want 1", n)
+	}
+}
+
+func TestTrapsDroppedAndCounted(t *testing.T) {
+	traps := map[string]string{
+		"long URL":         "http://example.com/?q=" + strings.Repeat("x", config.DefaultMaxURLLength),
+		"deep path":        "http://example.com" + strings.Repeat("/d", config.DefaultMaxSegments) + "/e",
+		"repeated segment": "http://example.com/a/b/a/c/a/a/",
+	}
+	for name, trap := range traps {
+		t.Run(name, func(t *testing.T) {
+			um := newTestManager(t, testConfig())
+			if um.Add(context.Background(), trap, 0) {
+				t.Errorf("Add enqueued %s", trap)
+			}
+			if um.Trapped() != 1 || um.Rejected() != 0 {
+				t.Errorf("Trapped() = %d, Rejected() = %d; want 1 and 0", um.Trapped(), um.Rejected())
+			}
+		})
+	}
+
+	um := newTestManager(t, testConfig())
+	um.Add(context.Background(), "http://example.com/a/b/a/c/a/", 0)
+	um.Add(context.Background(), "http://elsewhere.example/", 0)
+	if um.QueueLen() != 1 || um.Trapped() != 0 || um.Rejected() != 1 {
+		t.Errorf("queued %d, trapped %d, rejected %d; want 1, 0 and 1", um.QueueLen(), um.Trapped(), um.Rejected())
+	}
+}
+
+func TestTrapThresholdsConfigurable(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxSegmentRepeats = 0
+	cfg.MaxPathSegments = 2
+	um := newTestManager(t, cfg)
+	// Four segments exceed the limit of two, though repeats are allowed.
+	if um.Add(context.Background(), "http://example.com/a/a/a/a", 0) || um.Trapped() != 1 {
+		t.Errorf("URL four segments deep not trapped with max_path_segments 2")
+	}
+	if !um.Add(context.Background(), "http://example.com/a/a", 0) {
+		t.Error("URL within the limits was dropped")
+	}
+}
+
+// crawlOrder runs a single worker over the queue of um and returns the URLs
+// in the order they were handed out.
+func crawlOrder(um *UrlManager) []string {
+	var order []string
+	um.RunWorkers(context.Background(), 1, func(ctx context.Context, pageURL string, depth int) {
+		order = append(order, pageURL)
+	})
+	um.Wait()
+	return order
+}
+
+func TestMixedDepthsCrawledBreadthFirst(t *testing.T) {
+	um := newTestManager(t, testConfig())
+	adds := []struct {
+		path  string
+		depth int
+	}{{"d2a", 2}, {"d0", 0}, {"d1a", 1}, {"d2b", 2}, {"d1b", 1}, {"d3", 3}}
+	for _, a := range adds {
+		um.Add(context.Background(), "http://example.com/"+a.path, a.depth)
+	}
+	want := []string{"d0", "d1a", "d1b", "d2a", "d2b", "d3"}
+	got := crawlOrder(um)
+	for i := range got {
+		got[i] = strings.TrimPrefix(got[i], "http://example.com/")
+	}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("crawl order = %v, want %v", got, want)
+	}
+}
+
+func TestCustomPriority(t *testing.T) {
+	cfg := testConfig()
+	cfg.Priority = func(url string, depth int) int {
+		if strings.Contains(url, "/news/") {
+			return 10
+		}
+		return -depth
+	}
+	um := newTestManager(t, cfg)
+	for _, path := range []string{"about", "news/1", "contact", "news/2"} {
+		um.Add(context.Background(), "http://example.com/"+path, 1)
+	}
+	got := crawlOrder(um)
+	if len(got) != 4 || !strings.Contains(got[0], "news/1") || !strings.Contains(got[1], "news/2") {
+		t.Errorf("crawl order = %v, want the news pages first", got)
+	}
+}
+
+func TestIncludeExcludePatterns(t *testing.T) {
+	cfg := testConfig()
+	cfg.IncludePatterns = []string{`/blog/`}
+	cfg.ExcludePatterns = []string{`/drafts/`}
+	um := newTestManager(t, cfg)
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"http://example.com/blog/post", true},
+		{"http://example.com/about", false},
+		// Matching both, the exclude pattern wins.
+		{"http://example.com/blog/drafts/post", false},
+		{"http://example.com/drafts/note", false},
+	}
+	for _, tt := range tests {
+		if got := um.Add(context.Background(), tt.url, 1); got != tt.want {
+			t.Errorf("Add(%s) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+	if got := um.Rejected(); got != 3 {
+		t.Errorf("Rejected() = %d, want 3", got)
+	}
+}
+
+func TestInvalidPatternReturnsError(t *testing.T) {
+	for _, kind := range []string{"include", "exclude"} {
+		cfg := testConfig()
+		if kind == "include" {
+			cfg.IncludePatterns = []string{`/blog/`, `(unclosed`}
+		} else {
+			cfg.ExcludePatterns = []string{`[`}
+		}
+		um, err := NewUrlManager(cfg, nil)
+		if err == nil || !strings.Contains(err.Error(), "invalid "+kind+" pattern") {
+			t.Errorf("NewUrlManager error = %v, want an invalid %s pattern", err, kind)
+		}
+		if um != nil {
+			t.Errorf("NewUrlManager returned a manager along with an invalid %s pattern", kind)
+		}
+	}
+}
+
+func TestAdaptiveDelayFollowsLatency(t *testing.T) {
+	cfg := testConfig()
+	cfg.AdaptiveDelay = true
+	cfg.MinDelay = 100 * time.Millisecond
+	cfg.MaxDelay = 5 * time.Second
+	cfg.DelayFactor = 2
+	um := newTestManager(t, cfg)
+	delay := func() time.Duration {
+		d, ok := um.HostDelay("Example.com")
+		if !ok {
+			t.Fatal("HostDelay reports adaptive delays disabled")
+		}
+		return d
+	}
+
+	if d := delay(); d != cfg.MinDelay {
+		t.Errorf("delay before any response = %v, want the minimum", d)
+	}
+	last := delay()
+	for _, step := range []struct {
+		latency time.Duration
+		want    string
+	}{
+		{200 * time.Millisecond, "up"},
+		{time.Second, "up"},
+		{300 * time.Millisecond, "down"},
+		{10 * time.Millisecond, "down"},
+	} {
+		um.RecordLatency("example.com", step.latency)
+		d := delay()
+		if (step.want == "up" && d <= last) || (step.want == "down" && d >= last) {
+			t.Errorf("after a %v response the delay went from %v to %v, want it %s", step.latency, last, d, step.want)
+		}
+		last = d
+	}
+	if last != cfg.MinDelay {
+		t.Errorf("delay after a fast response = %v, want the %v minimum", last, cfg.MinDelay)
+	}
+	um.RecordLatency("example.com", time.Minute)
+	if d := delay(); d != cfg.MaxDelay {
+		t.Errorf("delay after a slow response = %v, want the %v maximum", d, cfg.MaxDelay)
+	}
+	if _, ok := newTestManager(t, testConfig()).HostDelay("example.com"); ok {
+		t.Error("HostDelay reports a delay with adaptive delays disabled")
+	}
+}
+
+func TestCrawlWaitsForLinksAddedMidFlight(t *testing.T) {
+	um := newTestManager(t, testConfig())
+	um.Add(context.Background(), "http://example.com/", 0)
+	var mu sync.Mutex
+	var done []string
+	um.RunWorkers(context.Background(), 4, func(ctx context.Context, pageURL string, depth int) {
+		// Only the slow seed finds links, well after the other workers
+		// have seen an empty queue.
+		if depth == 0 {
+			time.Sleep(50 * time.Millisecond)
+			for i := range 3 {
+				um.Add(ctx, fmt.Sprintf("http://example.com/%d", i), 1)
+			}
+		}
+		mu.Lock()
+		done = append(done, pageURL)
+		mu.Unlock()
+	})
+	select {
+	case <-um.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("crawl did not finish")
+	}
+	um.Wait()
+	if len(done) != 4 {
+		t.Errorf("crawled %v, want the seed and its 3 links", done)
+	}
+}
+
+func TestReservePageNeverOvershoots(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxPages = 5
+	um := newTestManager(t, cfg)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	stored := 0
+	for i := range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if !um.ReservePage() {
+				return
+			}
+			// Every third claim fails to store and hands its page back.
+			if i%3 == 0 {
+				um.ReleasePage()
+				return
+			}
+			mu.Lock()
+			stored++
+			mu.Unlock()
+			um.PageStored()
+		}()
+	}
+	wg.Wait()
+	if stored > 5 {
+		t.Errorf("%d pages stored with max_pages 5", stored)
+	}
+	if stored == 5 {
+		select {
+		case <-um.shutDownChannel:
+		default:
+			t.Error("manager not shut down after the page limit was reached")
+		}
+	}
+}
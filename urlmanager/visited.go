@@ -0,0 +1,136 @@
+package urlmanager
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"math"
+)
+
+const (
+	VisitedMap   = "map"
+	VisitedBloom = "bloom"
+)
+
+// VisitedSet records the URLs a crawl has seen. Implementations need not be
+// safe for concurrent use; UrlManager guards its set with its mutex.
+type VisitedSet interface {
+	// Add records url.
+	Add(url string)
+	// Contains reports whether url was added.
+	Contains(url string) bool
+	// Len returns the number of distinct URLs added, approximately for
+	// probabilistic sets.
+	Len() int
+}
+
+// MapSet is an exact VisitedSet. Its memory grows with every URL.
+type MapSet map[string]bool
+
+// NewMapSet returns an empty MapSet.
+func NewMapSet() MapSet {
+	return make(MapSet)
+}
+
+func (s MapSet) Add(url string)           { s[url] = true }
+func (s MapSet) Contains(url string) bool { return s[url] }
+func (s MapSet) Len() int                 { return len(s) }
+
+// BloomFilter is a fixed-size VisitedSet. Contains may report a URL that
+// was never added, which makes the crawl skip it, with a probability that
+// stays near the configured rate until more URLs than expected are added.
+type BloomFilter struct {
+	bits []uint64
+	k    uint64
+	n    int
+}
+
+// NewBloomFilter sizes a filter for expected URLs at the given false
+// positive rate.
+func NewBloomFilter(expected int, fpRate float64) *BloomFilter {
+	if expected < 1 {
+		expected = 1
+	}
+	if fpRate <= 0 || fpRate >= 1 {
+		fpRate = 0.001
+	}
+	m := math.Ceil(-float64(expected) * math.Log(fpRate) / (math.Ln2 * math.Ln2))
+	k := math.Max(1, math.Round(m/float64(expected)*math.Ln2))
+	return &BloomFilter{bits: make([]uint64, (uint64(m)+63)/64), k: uint64(k)}
+}
+
+func (b *BloomFilter) Add(url string) {
+	if b.Contains(url) {
+		return
+	}
+	h1, h2 := bloomHashes(url)
+	m := uint64(len(b.bits)) * 64
+	for i := uint64(0); i < b.k; i++ {
+		bit := (h1 + i*h2) % m
+		b.bits[bit/64] |= 1 << (bit % 64)
+	}
+	b.n++
+}
+
+func (b *BloomFilter) Contains(url string) bool {
+	h1, h2 := bloomHashes(url)
+	m := uint64(len(b.bits)) * 64
+	for i := uint64(0); i < b.k; i++ {
+		bit := (h1 + i*h2) % m
+		if b.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (b *BloomFilter) Len() int { return b.n }
+
+// MarshalBinary encodes the filter for the crawl state file.
+func (b *BloomFilter) MarshalBinary() ([]byte, error) {
+	data := make([]byte, 16, 16+8*len(b.bits))
+	binary.LittleEndian.PutUint64(data[0:], b.k)
+	binary.LittleEndian.PutUint64(data[8:], uint64(b.n))
+	for _, word := range b.bits {
+		data = binary.LittleEndian.AppendUint64(data, word)
+	}
+	return data, nil
+}
+
+// UnmarshalBinary restores a filter written by MarshalBinary.
+func (b *BloomFilter) UnmarshalBinary(data []byte) error {
+	if len(data) < 24 || len(data)%8 != 0 {
+		return errors.New("invalid bloom filter encoding")
+	}
+	b.k = binary.LittleEndian.Uint64(data[0:])
+	b.n = int(binary.LittleEndian.Uint64(data[8:]))
+	b.bits = make([]uint64, 0, (len(data)-16)/8)
+	for i := 16; i < len(data); i += 8 {
+		b.bits = append(b.bits, binary.LittleEndian.Uint64(data[i:]))
+	}
+	if b.k == 0 {
+		return errors.New("invalid bloom filter encoding")
+	}
+	return nil
+}
+
+// bloomHashes returns the two halves of the double hashing scheme. FNV
+// barely changes its upper bits for URLs differing only in their last
+// bytes, so each half is mixed before use. h2 is odd so successive probes
+// never repeat a bit early.
+func bloomHashes(url string) (uint64, uint64) {
+	h := fnv.New128a()
+	h.Write([]byte(url))
+	sum := h.Sum(nil)
+	return mix64(binary.BigEndian.Uint64(sum[:8])), mix64(binary.BigEndian.Uint64(sum[8:])) | 1
+}
+
+// mix64 is the MurmurHash3 finalizer.
+func mix64(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
@@ -0,0 +1,89 @@
+package urlmanager
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestVisitedSets(t *testing.T) {
+	sets := map[string]VisitedSet{
+		VisitedMap:   NewMapSet(),
+		VisitedBloom: NewBloomFilter(1000, 0.01),
+	}
+	for name, set := range sets {
+		t.Run(name, func(t *testing.T) {
+			for i := range 1000 {
+				url := fmt.Sprintf("http://example.com/%d", i)
+				set.Add(url)
+				set.Add(url)
+			}
+			for i := range 1000 {
+				if url := fmt.Sprintf("http://example.com/%d", i); !set.Contains(url) {
+					t.Fatalf("Contains(%s) = false after Add", url)
+				}
+			}
+			// A bloom filter may count a URL it takes for a duplicate.
+			if n := set.Len(); n > 1000 || n < 980 {
+				t.Errorf("Len() = %d after adding 1000 URLs twice", n)
+			}
+		})
+	}
+}
+
+func TestMapSetExact(t *testing.T) {
+	set := NewMapSet()
+	set.Add("http://example.com/")
+	if set.Contains("http://example.com/other") || set.Len() != 1 {
+		t.Errorf("map set reports URLs never added")
+	}
+}
+
+func TestBloomFilterFalsePositiveRate(t *testing.T) {
+	const rate = 0.01
+	for _, expected := range []int{1000, 10000} {
+		b := NewBloomFilter(expected, rate)
+		for i := range expected {
+			b.Add(fmt.Sprintf("http://example.com/seen/%d", i))
+		}
+		falsePositives := 0
+		for i := range expected {
+			if b.Contains(fmt.Sprintf("http://example.com/unseen/%d", i)) {
+				falsePositives++
+			}
+		}
+		if got := float64(falsePositives) / float64(expected); got > 2*rate {
+			t.Errorf("filter for %d URLs: false positive rate %.4f, configured %.4f", expected, got, rate)
+		}
+	}
+}
+
+func TestBloomFilterEncoding(t *testing.T) {
+	b := NewBloomFilter(100, 0.01)
+	b.Add("http://example.com/a")
+	data, err := b.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var restored BloomFilter
+	if err := restored.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if !restored.Contains("http://example.com/a") || restored.Len() != 1 {
+		t.Error("restored filter lost its contents")
+	}
+	if err := restored.UnmarshalBinary(data[:10]); err == nil {
+		t.Error("UnmarshalBinary accepted a truncated encoding")
+	}
+}
+
+func TestBloomVisitedSetSelected(t *testing.T) {
+	cfg := testConfig()
+	cfg.VisitedSet = VisitedBloom
+	um := newTestManager(t, cfg)
+	if _, ok := um.visited.(*BloomFilter); !ok {
+		t.Fatalf("visited set is %T with visited_set bloom", um.visited)
+	}
+	if !um.Add(t.Context(), "http://example.com/a", 1) || um.Add(t.Context(), "http://example.com/a", 1) {
+		t.Error("bloom visited set does not drop a repeated URL")
+	}
+}